@@ -0,0 +1,338 @@
+// Command dag inspects and plans dependency graphs written in JSON, YAML or DOT.
+//
+// Usage:
+//
+//	dag plan [--only NODE]... [--with-deps|--without-deps] FILE
+//	dag dot FILE
+//	dag cycles FILE
+//	dag ancestors NODE FILE
+//	dag descendants NODE FILE
+//	dag validate FILE
+//	dag diff OLD_FILE NEW_FILE
+//
+// The format of each file is told by its extension, i.e. ".json", ".yaml", ".yml", ".dot" or ".gv",
+// unless --format is given. Pass "-" as the file to read the graph from the standard input.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/variantdev/dag/pkg/strdag"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `Usage: dag COMMAND [FLAGS] ARGS
+
+Commands:
+  plan [--only NODE]... [--with-deps|--without-deps] FILE
+        print the plan, i.e. the groups of nodes to be processed in order
+  dot FILE
+        print the graph in the Graphviz DOT language
+  cycles FILE
+        print every cycle, and fail when there is any
+  ancestors NODE FILE
+        print the plan of the node and the nodes it depends on
+  descendants NODE FILE
+        print the plan of the node and the nodes depending on it
+  validate FILE
+        print every problem of the graph, and fail when there is any
+  diff OLD_FILE NEW_FILE
+        print the changes needed to turn the old graph into the new one
+
+Every command accepts --format json|yaml|dot to read files regardless of their extensions.
+`
+
+// errProblems is returned by commands that found problems in the graph, which are already printed
+var errProblems = errors.New("problems found")
+
+// stringsFlag is a flag that can be repeated
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+type command struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	format string
+}
+
+// run runs the command and returns the exit code, which is 1 on errors and problems found, and 2 on usage errors
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	c := &command{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	name, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("dag "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+	}
+	fs.StringVar(&c.format, "format", "", "format of the input files: json, yaml or dot")
+
+	var (
+		only        stringsFlag
+		withDeps    bool
+		withoutDeps bool
+	)
+
+	var (
+		numArgs int
+		cmd     func(args []string) error
+	)
+
+	switch name {
+	case "plan":
+		fs.Var(&only, "only", "include only the node in the plan. Can be repeated")
+		fs.BoolVar(&withDeps, "with-deps", false, "include the dependencies of the nodes given by --only")
+		fs.BoolVar(&withoutDeps, "without-deps", false, "exclude the dependencies of the nodes given by --only")
+		numArgs = 1
+		cmd = func(args []string) error {
+			return c.plan(args[0], only, withDeps, withoutDeps)
+		}
+	case "dot":
+		numArgs, cmd = 1, func(args []string) error { return c.dot(args[0]) }
+	case "cycles":
+		numArgs, cmd = 1, func(args []string) error { return c.cycles(args[0]) }
+	case "ancestors":
+		numArgs, cmd = 2, func(args []string) error { return c.ancestors(args[0], args[1]) }
+	case "descendants":
+		numArgs, cmd = 2, func(args []string) error { return c.descendants(args[0], args[1]) }
+	case "validate":
+		numArgs, cmd = 1, func(args []string) error { return c.validate(args[0]) }
+	case "diff":
+		numArgs, cmd = 2, func(args []string) error { return c.diff(args[0], args[1]) }
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if fs.NArg() != numArgs {
+		fmt.Fprintf(stderr, "dag %s: expected %d argument(s), got %d\n\n%s", name, numArgs, fs.NArg(), usage)
+		return 2
+	}
+
+	if err := cmd(fs.Args()); err != nil {
+		if err != errProblems {
+			fmt.Fprintf(stderr, "dag %s: %v\n", name, err)
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// load reads the graph from the file, or the standard input when the file is "-"
+func (c *command) load(file string) (*strdag.DAG, error) {
+	format := c.format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json":
+			format = "json"
+		case ".yaml", ".yml":
+			format = "yaml"
+		case ".dot", ".gv":
+			format = "dot"
+		default:
+			return nil, fmt.Errorf("unable to tell the format of %q: specify it with --format", file)
+		}
+	}
+
+	var r io.Reader = c.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch format {
+	case "json":
+		return strdag.ReadJSON(r)
+	case "yaml":
+		return strdag.ReadYAML(r, file)
+	case "dot":
+		return strdag.ReadDot(r)
+	}
+
+	return nil, fmt.Errorf("unsupported format %q: expected json, yaml or dot", format)
+}
+
+func (c *command) plan(file string, only []string, withDeps, withoutDeps bool) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	var opts []strdag.SortOption
+	if len(only) > 0 {
+		opts = append(opts, strdag.Only(only...))
+	}
+	if withDeps {
+		opts = append(opts, strdag.WithDependencies())
+	}
+	if withoutDeps {
+		opts = append(opts, strdag.WithoutDependencies())
+	}
+
+	res, err := g.Plan(opts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout, res.String())
+
+	return nil
+}
+
+func (c *command) dot(file string) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	return g.WriteDotTo(c.stdout)
+}
+
+func (c *command) cycles(file string) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	found := false
+
+	for _, err := range g.Validate() {
+		var (
+			ce  *strdag.CycleError
+			sle *strdag.SelfLoopError
+		)
+
+		switch {
+		case errors.As(err, &ce):
+			fmt.Fprintln(c.stdout, ce.Cycle.String())
+		case errors.As(err, &sle):
+			fmt.Fprintf(c.stdout, "%s -> %s\n", sle.Node, sle.Node)
+		default:
+			continue
+		}
+
+		found = true
+	}
+
+	if found {
+		return errProblems
+	}
+
+	return nil
+}
+
+func (c *command) ancestors(node, file string) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	res, err := g.Plan(strdag.Only(node), strdag.WithDependencies())
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return fmt.Errorf("node %q not found", node)
+	}
+
+	fmt.Fprintln(c.stdout, res.String())
+
+	return nil
+}
+
+func (c *command) descendants(node, file string) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	sub := g.Induced(func(id string) bool {
+		return id == node || g.Reachable(node, id)
+	})
+
+	res, err := sub.Plan()
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return fmt.Errorf("node %q not found", node)
+	}
+
+	fmt.Fprintln(c.stdout, res.String())
+
+	return nil
+}
+
+func (c *command) validate(file string) error {
+	g, err := c.load(file)
+	if err != nil {
+		return err
+	}
+
+	errs := g.Validate()
+
+	for _, err := range errs {
+		fmt.Fprintln(c.stdout, err)
+	}
+
+	if len(errs) > 0 {
+		return errProblems
+	}
+
+	return nil
+}
+
+func (c *command) diff(oldFile, newFile string) error {
+	a, err := c.load(oldFile)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.load(newFile)
+	if err != nil {
+		return err
+	}
+
+	return strdag.Diff(a, b).WriteTextTo(c.stdout)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const releases = `nodes:
+- name: web
+  dependsOn: [api, cache, net]
+- name: api
+  dependsOn: [db, cache, net]
+- name: db
+  dependsOn: [net]
+- name: mesh
+  dependsOn: [net]
+- name: cache
+- name: net
+`
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dag")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return path
+	}
+
+	yaml := write("releases.yaml", releases)
+	dot := write("releases.dot", `digraph { net -> api -> web; net -> db -> api; db -> net }`)
+	json := write("releases.json", `{"version":1,"nodes":[{"id":"api"},{"id":"web"}],"edges":[{"from":"api","to":"web"}]}`)
+
+	testcases := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{args: []string{"plan", yaml}, stdout: "cache, net -> db, mesh -> api -> web\n"},
+		{args: []string{"plan", "--only", "api", "--with-deps", yaml}, stdout: "cache, net -> db -> api\n"},
+		{args: []string{"plan", "--only", "api", yaml}, code: 1, stderr: `dag plan: "db" depended by "api" is not included` + "\n"},
+		{args: []string{"plan", "--format", "yaml", "-"}, stdin: releases, stdout: "cache, net -> db, mesh -> api -> web\n"},
+		{args: []string{"plan", json}, stdout: "api -> web\n"},
+		{args: []string{"ancestors", "db", yaml}, stdout: "net -> db\n"},
+		{args: []string{"descendants", "db", yaml}, stdout: "db -> api -> web\n"},
+		{args: []string{"descendants", "unknown", yaml}, code: 1, stderr: "dag descendants: node \"unknown\" not found\n"},
+		{args: []string{"cycles", yaml}},
+		{args: []string{"cycles", dot}, code: 1, stdout: "db -> net -> db\n"},
+		{args: []string{"validate", dot}, code: 1, stdout: "cycle detected: db -> net -> db\n"},
+		{args: []string{"diff", json, dot}, stdout: "+ node db\n+ node net\n+ edge db -> api\n+ edge db -> net\n+ edge net -> api\n+ edge net -> db\n"},
+		{args: []string{"dot", json}, stdout: "digraph DAG {\nrankdir=\"LR\"\n\"api\" [shape=record, label=\"{api}\"]\n\"web\" [shape=record, label=\"{web}\"]\n\"api\" -> \"web\"\n}\n"},
+		{args: []string{"plan", "releases.txt"}, code: 1, stderr: "dag plan: unable to tell the format of \"releases.txt\": specify it with --format\n"},
+		{args: []string{"plan"}, code: 2},
+		{args: []string{"unknown"}, code: 2},
+	}
+
+	for _, tc := range testcases {
+		var stdout, stderr bytes.Buffer
+
+		code := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+
+		if code != tc.code {
+			t.Errorf("%v: unexpected exit code: expected=%d, got=%d: %s", tc.args, tc.code, code, stderr.String())
+		}
+
+		if actual := stdout.String(); actual != tc.stdout {
+			t.Errorf("%v: unexpected stdout: expected=%q, got=%q", tc.args, tc.stdout, actual)
+		}
+
+		if tc.code != 2 && stderr.String() != tc.stderr {
+			t.Errorf("%v: unexpected stderr: expected=%q, got=%q", tc.args, tc.stderr, stderr.String())
+		}
+	}
+}
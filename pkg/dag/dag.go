@@ -1,9 +1,11 @@
 package dag
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 )
 
 type Option func(*DAG)
@@ -26,6 +28,22 @@ func Nodes(nodes []Key) Option {
 	}
 }
 
+// Strict makes the graph reject edges from or to nodes that are not added yet, instead of deferring the check to Sort.
+// AddEdgeE and AddDependencyE return *UndefinedNodeError for such edges, while the other methods return false.
+func Strict() Option {
+	return func(g *DAG) {
+		g.strict = true
+	}
+}
+
+// ThreadSafe makes the graph safe for concurrent use by guarding every method with a read-write mutex.
+// Mutators are serialized while queries like Sort and WriteDotTo run concurrently.
+func ThreadSafe() Option {
+	return func(g *DAG) {
+		g.mu = &sync.RWMutex{}
+	}
+}
+
 type Key interface {
 	Less(r Key) bool
 }
@@ -33,41 +51,134 @@ type Key interface {
 type DAG struct {
 	cap       int
 	initNodes []Key
+	strict    bool
 
+	undefinedPolicy UndefinedDependencyPolicy
+	warn            func(error)
+
+	// nodes is the list of nodes in the order of addition
 	nodes []Key
 	// a.k.a dependents of the node denoted by the key
 	// `outputs["api"]["web"] = true` means api's sole dependent is "web"
 	// i.e. "web" depends on "api"
 	outputs map[Key]map[Key]bool
 	labels  map[Key]map[string]bool
-	// a.k.a number of dependenciesthat the node denoted by the key has.
-	// `numInputs["web"] = 2` means "web" has 2 dependencies.
-	numInputs map[Key]int
+
+	// ids denotes every node and every endpoint of edges by an index into keys,
+	// so that Sort works on slices rather than maps.
+	ids  map[Key]int
+	keys []Key
+	// defined tells whether the key at the index is added as a node, rather than only referenced by edges.
+	// This is the only source of truth about which nodes are defined.
+	defined []bool
+	// children is the slice-based counterpart of outputs
+	children [][]int
+	// a.k.a number of dependenciesthat the node denoted by the index has.
+	// `numInputs[ids["web"]] = 2` means "web" has 2 dependencies.
+	numInputs []int
+
+	// ranks is the position of each key in keys when ordered by Key.Less.
+	// It is computed by Sort whenever keys are added, and guarded by ranksMu as Sort runs under the read lock.
+	ranks   []int
+	ranksMu sync.Mutex
+
+	// duplicates is the set of edges added more than once, reported by Validate
+	duplicates map[Edge]bool
+
+	// reachable caches the nodes reachable from each node queried via Reachable.
+	// It is reset whenever a node is added or an edge is added or removed,
+	// and guarded by reachableMu as Reachable runs under the read lock.
+	reachable   map[Key]map[Key]bool
+	reachableMu sync.Mutex
+
+	// mu is set only when the graph is created with the ThreadSafe option
+	mu *sync.RWMutex
+
+	// inc is set only when the graph is created with the Incremental option
+	inc *incrementalState
+}
+
+func (g *DAG) lock() {
+	if g.mu != nil {
+		g.mu.Lock()
+	}
+}
+
+func (g *DAG) unlock() {
+	if g.mu != nil {
+		g.mu.Unlock()
+	}
+}
+
+func (g *DAG) rlock() {
+	if g.mu != nil {
+		g.mu.RLock()
+	}
+}
+
+func (g *DAG) runlock() {
+	if g.mu != nil {
+		g.mu.RUnlock()
+	}
 }
 
 func (g *DAG) AddNode(key Key) bool {
-	if _, ok := g.numInputs[key]; ok {
+	g.lock()
+	defer g.unlock()
+
+	return g.addNode(key)
+}
+
+// addNode adds the node unless it is already added, in which case it returns false
+func (g *DAG) addNode(key Key) bool {
+	i := g.id(key)
+
+	if g.defined[i] {
 		return false
 	}
 
+	g.defined[i] = true
 	g.nodes = append(g.nodes, key)
 
-	if _, ok := g.outputs[key]; !ok {
-		g.outputs[key] = make(map[Key]bool)
-	}
+	// Defining a node referred to by edges changes which edges Sort takes into account
+	g.reachable = nil
 
-	if _, ok := g.numInputs[key]; ok {
-		g.numInputs[key] = 0
+	if g.inc != nil {
+		g.inc.nodeAdded(g, key)
 	}
 
 	return true
 }
 
+// isDefined returns true when the key is added as a node
+func (g *DAG) isDefined(key Key) bool {
+	i, ok := g.ids[key]
+
+	return ok && g.defined[i]
+}
+
+// id returns the index of the key, allocating one when the key is seen for the first time
+func (g *DAG) id(key Key) int {
+	if i, ok := g.ids[key]; ok {
+		return i
+	}
+
+	i := len(g.keys)
+
+	g.ids[key] = i
+	g.keys = append(g.keys, key)
+	g.defined = append(g.defined, false)
+	g.children = append(g.children, nil)
+	g.numInputs = append(g.numInputs, 0)
+
+	return i
+}
+
 func New(opt ...Option) *DAG {
 	g := &DAG{
-		numInputs: make(map[Key]int),
-		outputs:   make(map[Key]map[Key]bool),
-		labels:    make(map[Key]map[string]bool),
+		outputs: make(map[Key]map[Key]bool),
+		labels:  make(map[Key]map[string]bool),
+		ids:     make(map[Key]int),
 	}
 
 	for _, o := range opt {
@@ -75,41 +186,182 @@ func New(opt ...Option) *DAG {
 	}
 
 	g.nodes = make([]Key, 0, g.cap)
+	g.keys = make([]Key, 0, g.cap)
+	g.defined = make([]bool, 0, g.cap)
+	g.children = make([][]int, 0, g.cap)
+	g.numInputs = make([]int, 0, g.cap)
 
 	g.AddNodes(g.initNodes...)
 
 	return g
 }
 
+// Clone returns a deep copy of the graph, so that the copy can be mutated without affecting the original
+func (g *DAG) Clone() *DAG {
+	g.rlock()
+	defer g.runlock()
+
+	c := &DAG{
+		cap:       g.cap,
+		initNodes: append([]Key{}, g.initNodes...),
+
+		nodes:     make([]Key, len(g.nodes), cap(g.nodes)),
+		outputs:   make(map[Key]map[Key]bool, len(g.outputs)),
+		labels:    make(map[Key]map[string]bool, len(g.labels)),
+		numInputs: append([]int{}, g.numInputs...),
+		ids:       make(map[Key]int, len(g.ids)),
+		keys:      append([]Key{}, g.keys...),
+		defined:   append([]bool{}, g.defined...),
+		children:  make([][]int, len(g.children)),
+	}
+
+	copy(c.nodes, g.nodes)
+
+	for k, v := range g.ids {
+		c.ids[k] = v
+	}
+
+	for i, v := range g.children {
+		c.children[i] = append([]int(nil), v...)
+	}
+
+	for k, v := range g.outputs {
+		c.outputs[k] = make(map[Key]bool, len(v))
+		for k2, v2 := range v {
+			c.outputs[k][k2] = v2
+		}
+	}
+
+	if g.duplicates != nil {
+		c.duplicates = make(map[Edge]bool, len(g.duplicates))
+		for e := range g.duplicates {
+			c.duplicates[e] = true
+		}
+	}
+
+	for k, v := range g.labels {
+		c.labels[k] = make(map[string]bool, len(v))
+		for k2, v2 := range v {
+			c.labels[k][k2] = v2
+		}
+	}
+
+	g.copyOptionsTo(c)
+
+	return c
+}
+
+// newLike returns a new empty graph created with the same options as g other than the initial nodes
+func (g *DAG) newLike(capacity int) *DAG {
+	c := New(Capacity(capacity))
+
+	g.copyOptionsTo(c)
+
+	return c
+}
+
+// copyOptionsTo applies the options g is created with to c, which must not be shared yet
+func (g *DAG) copyOptionsTo(c *DAG) {
+	c.strict = g.strict
+
+	c.undefinedPolicy = g.undefinedPolicy
+	c.warn = g.warn
+
+	if g.mu != nil {
+		c.mu = &sync.RWMutex{}
+	}
+
+	if g.inc != nil {
+		// Let the first sort of the copy rebuild the state
+		c.inc = &incrementalState{}
+	}
+}
+
+// AddNodes adds the nodes, returning false when any of them is already added
 func (g *DAG) AddNodes(names ...Key) bool {
+	g.lock()
+	defer g.unlock()
+
+	added := true
 	for _, name := range names {
-		if ok := g.AddNode(name); !ok {
-			return false
+		if ok := g.addNode(name); !ok {
+			added = false
 		}
 	}
-	return true
+	return added
 }
 
 func (g *DAG) AddEdge(from, to Key) bool {
+	return g.AddEdgeE(from, to) == nil
+}
+
+// AddEdgeE is the same as AddEdge but returns *UndefinedNodeError
+// when either end of the edge is not added yet and the graph is Strict.
+func (g *DAG) AddEdgeE(from, to Key) error {
+	g.lock()
+	defer g.unlock()
+
+	return g.addEdge(from, to)
+}
+
+func (g *DAG) addEdge(from, to Key) error {
+	if g.strict {
+		for _, k := range []Key{from, to} {
+			if !g.isDefined(k) {
+				return &UndefinedNodeError{Node: k, Edge: Edge{From: from, To: to}}
+			}
+		}
+	}
+
 	m, ok := g.outputs[from]
 	if !ok {
 		m = map[Key]bool{}
 		g.outputs[from] = m
 	}
 
+	if m[to] {
+		if g.duplicates == nil {
+			g.duplicates = map[Edge]bool{}
+		}
+		g.duplicates[Edge{From: from, To: to}] = true
+		return nil
+	}
+
+	i, j := g.id(from), g.id(to)
+
 	m[to] = true
-	g.numInputs[to]++
+	g.children[i] = append(g.children[i], j)
+	g.numInputs[j]++
 
-	return true
+	g.reachable = nil
+
+	if g.inc != nil {
+		g.inc.edgeAdded(g, from, to)
+	}
+
+	return nil
 }
 
 func (g *DAG) AddDependency(sub Key, dependencies ...Key) bool {
+	return g.AddDependencyE(sub, dependencies...) == nil
+}
+
+// AddDependencyE is the same as AddDependency but returns *UndefinedNodeError
+// when the node or any of its dependencies is not added yet and the graph is Strict.
+func (g *DAG) AddDependencyE(sub Key, dependencies ...Key) error {
+	g.lock()
+	defer g.unlock()
+
+	return g.addDependencies(sub, dependencies)
+}
+
+func (g *DAG) addDependencies(sub Key, dependencies []Key) error {
 	for _, d := range dependencies {
-		if r := g.AddEdge(d, sub); !r {
-			return false
+		if err := g.addEdge(d, sub); err != nil {
+			return err
 		}
 	}
-	return true
+	return nil
 }
 
 func (g *DAG) AddDependencies(sub Key, dependencies []Key) bool {
@@ -117,6 +369,13 @@ func (g *DAG) AddDependencies(sub Key, dependencies []Key) bool {
 }
 
 func (g *DAG) AddLabel(sub Key, labels ...string) {
+	g.lock()
+	defer g.unlock()
+
+	g.addLabels(sub, labels)
+}
+
+func (g *DAG) addLabels(sub Key, labels []string) {
 	for _, d := range labels {
 		m, ok := g.labels[sub]
 		if !ok {
@@ -156,22 +415,44 @@ func (g *DAG) Add(node Key, opt ...AddOption) bool {
 		o(opts)
 	}
 
-	g.AddNode(node)
+	g.lock()
+	defer g.unlock()
 
-	deps := g.AddDependencies(node, opts.deps)
+	g.addNode(node)
 
-	g.AddLabels(node, opts.labels)
+	err := g.addDependencies(node, opts.deps)
 
-	return deps
+	g.addLabels(node, opts.labels)
+
+	return err == nil
 }
 
+// unsafeRemoveEdge removes the edge, which must exist
 func (g *DAG) unsafeRemoveEdge(from, to Key) {
+	i, j := g.ids[from], g.ids[to]
+	for k, c := range g.children[i] {
+		if c == j {
+			g.children[i] = append(g.children[i][:k], g.children[i][k+1:]...)
+			break
+		}
+	}
+
 	delete(g.outputs[from], to)
-	g.numInputs[to]--
+	delete(g.duplicates, Edge{From: from, To: to})
+	g.numInputs[j]--
+
+	g.reachable = nil
+
+	if g.inc != nil {
+		g.inc.edgeRemoved(g, from, to)
+	}
 }
 
 func (g *DAG) RemoveEdge(from, to Key) bool {
-	if _, ok := g.outputs[from]; !ok {
+	g.lock()
+	defer g.unlock()
+
+	if !g.outputs[from][to] {
 		return false
 	}
 	g.unsafeRemoveEdge(from, to)
@@ -182,12 +463,26 @@ type NodeInfo struct {
 	Id        Key
 	ParentIds []Key
 	ChildIds  []Key
+
+	// Placeholder is true when the node is not added to the graph but included as it is referred to by edges.
+	// See PlaceholderForUndefined.
+	Placeholder bool
 }
 
 func (n *NodeInfo) String() string {
 	return fmt.Sprintf("%s", n.Id)
 }
 
+// Edge is a directed edge from a dependency to its dependent
+type Edge struct {
+	From Key
+	To   Key
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("%s -> %s", e.From, e.To)
+}
+
 // Cycle is not a loop :)
 // See https://math.stackexchange.com/questions/1490053
 type Cycle struct {
@@ -209,6 +504,8 @@ func (g *DAG) Plan(opts ...SortOption) (Topology, error) {
 
 type Topology [][]*NodeInfo
 
+// String returns the groups of nodes in order, like "cache, net -> db, mesh -> api -> web".
+// Backslashes, commas and arrows in keys are escaped with backslashes so that ParseTopology can read it back.
 func (r Topology) String() string {
 	if len(r) == 0 {
 		return ""
@@ -224,7 +521,11 @@ func (r Topology) String() string {
 		sort.Slice(ids, func(i, j int) bool {
 			return ids[i].Less(ids[j])
 		})
-		res = append(res, strings.Join(KeysToStringSlice(ids), ", "))
+		names := KeysToStringSlice(ids)
+		for i, n := range names {
+			names[i] = escapeTopologyKey(n)
+		}
+		res = append(res, strings.Join(names, ", "))
 	}
 
 	return strings.Join(res, " -> ")
@@ -244,33 +545,40 @@ func KeysToStringSlice(ks []Key) []string {
 	return ss
 }
 
-func depthFirstPrint(nodes map[Key]*NodeInfo, level int, levels map[int]map[Key]bool, n *NodeInfo) [][]string {
-	lines := [][]string{}
-
-	if len(n.ChildIds) == 0 {
-		return [][]string{{sprintKey(n.Id)}}
+// sortedNodes returns the distinct nodes of the graph ordered by Key.Less.
+func (g *DAG) sortedNodes() []Key {
+	set := make(map[Key]bool, len(g.nodes))
+	for _, n := range g.nodes {
+		set[n] = true
 	}
 
-	for _, child := range n.ChildIds {
-		if ok := levels[level+1][child]; !ok {
-			continue
-		}
-		childLines := depthFirstPrint(nodes, level+1, levels, nodes[child])
-
-		for i, line := range childLines {
-			var header []string
-			if i == 0 {
-				header = []string{sprintKey(n.Id)}
-			} else {
-				header = []string{""}
-			}
-			lines = append(lines, append(header, line...))
-		}
+	return sortedKeys(set)
+}
+
+// sortedKeys returns the keys of the set ordered by Key.Less.
+func sortedKeys(set map[Key]bool) []Key {
+	keys := make([]Key, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
 	}
 
-	return lines
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Less(keys[j])
+	})
+
+	return keys
 }
 
+// Sentinel errors for telling the kind of an error with errors.Is, regardless of its concrete type.
+var (
+	// ErrCycle is matched by *Error and *SelfLoopError
+	ErrCycle = errors.New("cycle detected")
+	// ErrUndefined is matched by *UndefinedDependencyError, *UndefinedDependentError and *UndefinedNodeError
+	ErrUndefined = errors.New("undefined node")
+	// ErrUnhandled is matched by *UnhandledDependencyError
+	ErrUnhandled = errors.New("unhandled dependency")
+)
+
 type Error struct {
 	Cycle *Cycle
 }
@@ -279,6 +587,24 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("cycle detected: %v", e.Cycle)
 }
 
+func (e *Error) Is(target error) bool {
+	return target == ErrCycle
+}
+
+// SelfLoopError is returned by Sort when a node depends on itself, which is reported in favor of other cycles
+// as it is the most common mistake in configurations.
+type SelfLoopError struct {
+	Node Key
+}
+
+func (e *SelfLoopError) Error() string {
+	return fmt.Sprintf("self-loop detected: node %q depends on itself", e.Node)
+}
+
+func (e *SelfLoopError) Is(target error) bool {
+	return target == ErrCycle
+}
+
 type UndefinedDependencyError struct {
 	UndefinedNode Key
 	Dependents    []Key
@@ -288,6 +614,39 @@ func (e *UndefinedDependencyError) Error() string {
 	return fmt.Sprintf("undefined node %q is depended by node(s): %s", e.UndefinedNode, strings.Join(KeysToStringSlice(e.Dependents), ", "))
 }
 
+func (e *UndefinedDependencyError) Is(target error) bool {
+	return target == ErrUndefined
+}
+
+// UndefinedDependentError is returned by Sort when a node that is never added depends on other nodes,
+// e.g. when AddDependency is called for a node that is misspelled.
+type UndefinedDependentError struct {
+	UndefinedNode Key
+	Dependencies  []Key
+}
+
+func (e *UndefinedDependentError) Error() string {
+	return fmt.Sprintf("undefined node %q depends on node(s): %s", e.UndefinedNode, strings.Join(KeysToStringSlice(e.Dependencies), ", "))
+}
+
+func (e *UndefinedDependentError) Is(target error) bool {
+	return target == ErrUndefined
+}
+
+// UndefinedNodeError is returned when adding an edge from or to a node that is not added yet to a Strict graph
+type UndefinedNodeError struct {
+	Node Key
+	Edge Edge
+}
+
+func (e *UndefinedNodeError) Error() string {
+	return fmt.Sprintf("cannot add edge %s: undefined node %q", e.Edge, e.Node)
+}
+
+func (e *UndefinedNodeError) Is(target error) bool {
+	return target == ErrUndefined
+}
+
 type UnhandledDependencyError struct {
 	UnhandledDependencies []UnhandledDependency
 }
@@ -318,6 +677,10 @@ func (e *UnhandledDependencyError) Error() string {
 	return fmt.Sprintf("%q depended by %s is not included", ud.Id, ds)
 }
 
+func (e *UnhandledDependencyError) Is(target error) bool {
+	return target == ErrUnhandled
+}
+
 type SortOptions struct {
 	Only []Key
 
@@ -368,157 +731,43 @@ func WithoutDependencies() SortOption {
 
 // Sort topologically sorts the nodes while grouping nodes at the same "depth" into a same group
 func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
+	g.rlock()
+	defer g.runlock()
+
+	return g.sort(opts...)
+}
+
+func (g *DAG) sort(opts ...SortOption) (Topology, error) {
 	var options SortOptions
 
 	for _, o := range opts {
 		o.ApplySortOptions(&options)
 	}
 
-	var only map[Key]struct{}
+	// only tells whether the node at the index is selected
+	var only []bool
 
 	if len(options.Only) > 0 {
-		only = map[Key]struct{}{}
+		only = make([]bool, len(g.keys))
 
 		for _, o := range options.Only {
-			only[o] = struct{}{}
-		}
-	}
-
-	numInputs := map[Key]int{}
-	for k, v := range g.numInputs {
-		numInputs[k] = v
-	}
-
-	outputs := map[Key]map[Key]bool{}
-	for k, v := range g.outputs {
-		outputs[k] = map[Key]bool{}
-		for k2, v2 := range v {
-			outputs[k][k2] = v2
+			if i, ok := g.ids[o]; ok {
+				only[i] = true
+			}
 		}
 	}
 
 	withDeps := options.WithDependencies
 	withoutDeps := options.WithoutDependencies
 
-	nodes := map[Key]*NodeInfo{}
-	current := make([]*NodeInfo, 0, len(g.nodes))
-
-	for _, n := range g.nodes {
-		info := &NodeInfo{Id: n}
-		nodes[n] = info
-		if numInputs[n] == 0 {
-			current = append(current, info)
-		}
-	}
-
-	for dep, dependents := range outputs {
-		if _, ok := nodes[dep]; !ok {
-			var dependentsNames []Key
-			for d := range dependents {
-				dependentsNames = append(dependentsNames, d)
-			}
-			return nil, &UndefinedDependencyError{
-				UndefinedNode: dep,
-				Dependents:    dependentsNames,
-			}
-		}
-	}
-
-	// We sort sets of nodes rather than nodes themselves,
-	// so that we know which items can be processed in parallel in the DAG
-	// See https://cs.stackexchange.com/questions/2524/getting-parallel-items-in-dependency-resolution
-	sortedSets := map[int][]*NodeInfo{}
-
-	next := []*NodeInfo{}
-
-	depth := 0
-	for len(current) > 0 {
-		var n *NodeInfo
-		n, current = current[0], current[1:]
-		sortedSets[depth] = append(sortedSets[depth], n)
-
-		ms := make([]Key, len(outputs[n.Id]))
-		i := 0
-		for m := range outputs[n.Id] {
-			ms[i] = m
-			i++
-		}
-
-		for _, m := range ms {
-			// unsafeRemoveEdge
-			from, to := n.Id, m
-			delete(outputs[from], to)
-			numInputs[to]--
-
-			mm := nodes[m]
-			mm.ParentIds = append(mm.ParentIds, n.Id)
-
-			n.ChildIds = append(n.ChildIds, mm.Id)
-
-			if numInputs[m] == 0 {
-				next = append(next, mm)
-			}
-		}
-
-		if len(current) == 0 {
-			current = next
-			next = []*NodeInfo{}
-			depth += 1
-		}
+	sortedSets, sortedIds, err := g.groups()
+	if err != nil {
+		return sortedSets, err
 	}
 
-	invalidNodes := []*NodeInfo{}
-
-	numUnresolvedEdges := 0
-	for id, v := range numInputs {
-		numUnresolvedEdges += v
-
-		if v > 0 {
-			invalidNodes = append(invalidNodes, nodes[id])
-		}
-	}
-
-	if numUnresolvedEdges > 0 {
-		var cur Key
-
-		// Sort Ids to make the result stable
-		sorted := []Key{}
-		for _, n := range invalidNodes {
-			sorted = append(sorted, n.Id)
-		}
-
-		sort.Slice(sorted, func(i, j int) bool {
-			return sorted[i].Less(sorted[j])
-		})
-
-		for _, id := range sorted {
-			if len(outputs[id]) > 0 {
-				cur = id
-				break
-			}
-		}
-		if cur == nil {
-			panic(fmt.Errorf("invalid state: no nodes have remaining edges: nodes=%v", invalidNodes))
-		}
-		seen := map[Key]bool{}
-		path := []Key{}
-
-		for !seen[cur] {
-			seen[cur] = true
-			path = append(path, cur)
-			for k, _ := range outputs[cur] {
-				cur = k
-				break
-			}
-		}
-		path = append(path, cur)
-
-		r := make(Topology, len(sortedSets))
-		for k, v := range sortedSets {
-			r[k] = v
-		}
-
-		return r, &Error{Cycle: &Cycle{Path: path}}
+	if only == nil {
+		// Every group is already ordered by Key.Less
+		return append(Topology{}, sortedSets...), nil
 	}
 
 	r := make(Topology, len(sortedSets))
@@ -526,17 +775,13 @@ func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
 	for k := len(sortedSets) - 1; k >= 0; k-- {
 		v := sortedSets[k]
 
-		var included []*NodeInfo
+		included := make([]*NodeInfo, 0, len(v))
 
 		for i := range v {
 			node := v[i]
+			id := sortedIds[k][i]
 
-			if only == nil {
-				included = append(included, node)
-				continue
-			}
-
-			if _, ok := only[node.Id]; ok {
+			if only[id] {
 				included = append(included, node)
 				continue
 			}
@@ -548,12 +793,11 @@ func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
 			var depended bool
 			var dependents []Key
 
-			allDependents := g.outputs[node.Id]
-			for target := range only {
-				if allDependents[target] {
+			for _, j := range g.children[id] {
+				if only[j] {
 					// This node is depended by one of the selected nodes
 					depended = true
-					dependents = append(dependents, target)
+					dependents = append(dependents, g.keys[j])
 				}
 			}
 
@@ -578,7 +822,7 @@ func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
 
 				// To include any transitive dependencies of the this node into the dag,
 				// we treat this node as included in the selected nodes list.
-				only[node.Id] = struct{}{}
+				only[id] = true
 				included = append(included, node)
 				continue
 			}
@@ -588,10 +832,7 @@ func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
 			continue
 		}
 
-		sort.Slice(included, func(i, j int) bool {
-			return included[i].Id.Less(included[j].Id)
-		})
-
+		// included keeps the order of the group, which is ordered by Key.Less
 		r[k] = included
 	}
 
@@ -605,3 +846,243 @@ func (g *DAG) Sort(opts ...SortOption) (Topology, error) {
 
 	return res, nil
 }
+
+// groups returns all the nodes grouped by depth along with the indices of the nodes in each group,
+// or the partial result along with the error when the graph has an undefined dependency or a cycle.
+func (g *DAG) groups() (Topology, [][]int, error) {
+	if g.inc != nil {
+		return g.incrementalGroups()
+	}
+
+	return g.computeGroups()
+}
+
+func (g *DAG) computeGroups() (Topology, [][]int, error) {
+	n := len(g.keys)
+
+	numEdges := 0
+	numInputs := make([]int, n)
+
+	present, err := g.presentNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, children := range g.children {
+		if !present[i] || len(children) == 0 {
+			continue
+		}
+
+		for _, j := range children {
+			if present[j] {
+				numInputs[j]++
+			}
+		}
+		numEdges += len(children)
+	}
+
+	// Allocate all the node infos and their parent and child ids at once,
+	// as allocating them one by one dominates the time taken to sort a large graph
+	infos := make([]NodeInfo, n)
+	ids := make([]Key, 2*numEdges)
+
+	current := make([]int, 0, n)
+
+	for i := 0; i < n; i++ {
+		infos[i].Id = g.keys[i]
+		infos[i].Placeholder = !g.defined[i]
+
+		if !present[i] {
+			continue
+		}
+
+		infos[i].ParentIds, ids = ids[:0:numInputs[i]], ids[numInputs[i]:]
+		infos[i].ChildIds, ids = ids[:0:len(g.children[i])], ids[len(g.children[i]):]
+
+		if numInputs[i] == 0 {
+			current = append(current, i)
+		}
+	}
+
+	// We sort sets of nodes rather than nodes themselves,
+	// so that we know which items can be processed in parallel in the DAG
+	// See https://cs.stackexchange.com/questions/2524/getting-parallel-items-in-dependency-resolution
+	var (
+		sortedSets Topology
+		sortedIds  [][]int
+	)
+
+	numSorted := 0
+
+	ranks := g.keyRanks()
+
+	for len(current) > 0 {
+		// Order each set by Key.Less in advance, which is way cheaper than sorting NodeInfos by Key.Less afterwards
+		sort.Slice(current, func(i, j int) bool {
+			return ranks[current[i]] < ranks[current[j]]
+		})
+
+		set := make([]*NodeInfo, len(current))
+		next := []int{}
+
+		for k, i := range current {
+			n := &infos[i]
+			set[k] = n
+
+			for _, j := range g.children[i] {
+				if !present[j] {
+					continue
+				}
+
+				m := &infos[j]
+				m.ParentIds = append(m.ParentIds, n.Id)
+
+				n.ChildIds = append(n.ChildIds, m.Id)
+
+				numInputs[j]--
+				if numInputs[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+
+		sortedSets = append(sortedSets, set)
+		sortedIds = append(sortedIds, current)
+		numSorted += len(current)
+		current = next
+	}
+
+	numPresent := 0
+	for _, p := range present {
+		if p {
+			numPresent++
+		}
+	}
+
+	if numSorted < numPresent {
+		if k, ok := g.leastSelfLoop(numInputs); ok {
+			return sortedSets, sortedIds, &SelfLoopError{Node: k}
+		}
+
+		return sortedSets, sortedIds, &Error{Cycle: &Cycle{Path: findCycle(g.keys, g.children, numInputs)}}
+	}
+
+	return sortedSets, sortedIds, nil
+}
+
+// keyRanks returns the positions of keys when ordered by Key.Less
+func (g *DAG) keyRanks() []int {
+	g.ranksMu.Lock()
+	defer g.ranksMu.Unlock()
+
+	if len(g.ranks) == len(g.keys) {
+		return g.ranks
+	}
+
+	order := make([]int, len(g.keys))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return g.keys[order[i]].Less(g.keys[order[j]])
+	})
+
+	g.ranks = make([]int, len(g.keys))
+	for r, i := range order {
+		g.ranks[i] = r
+	}
+
+	return g.ranks
+}
+
+func (g *DAG) keysOf(ids []int) []Key {
+	keys := make([]Key, len(ids))
+	for i, id := range ids {
+		keys[i] = g.keys[id]
+	}
+	return keys
+}
+
+// leastSelfLoop returns the least node left unsorted, i.e. having non-zero numInputs, that depends on itself
+func (g *DAG) leastSelfLoop(numInputs []int) (Key, bool) {
+	var least Key
+
+	for i, n := range numInputs {
+		if n == 0 || !g.outputs[g.keys[i]][g.keys[i]] {
+			continue
+		}
+
+		if least == nil || g.keys[i].Less(least) {
+			least = g.keys[i]
+		}
+	}
+
+	return least, least != nil
+}
+
+// findCycle returns a cycle among the nodes left unsorted, i.e. the ones having non-zero numInputs.
+//
+// Every unsorted node has at least one unsorted dependency, so following dependencies from any unsorted node
+// always ends up in a cycle. The cycle is returned in the direction of edges, starting from its least node.
+func findCycle(keys []Key, children [][]int, numInputs []int) []Key {
+	less := func(i, j int) bool {
+		return keys[i].Less(keys[j])
+	}
+
+	parents := make([][]int, len(keys))
+
+	start := -1
+
+	for i := range keys {
+		if numInputs[i] == 0 {
+			continue
+		}
+
+		if start < 0 || less(i, start) {
+			start = i
+		}
+
+		for _, j := range children[i] {
+			parents[j] = append(parents[j], i)
+		}
+	}
+
+	if start < 0 {
+		panic(fmt.Errorf("invalid state: no nodes are left unsorted: nodes=%v", keys))
+	}
+
+	seen := map[int]int{}
+	path := []int{}
+
+	cur := start
+	for {
+		if pos, ok := seen[cur]; ok {
+			path = path[pos:]
+			break
+		}
+		seen[cur] = len(path)
+		path = append(path, cur)
+
+		// Stick to the least dependency to make the result stable
+		sort.Slice(parents[cur], func(i, j int) bool {
+			return less(parents[cur][i], parents[cur][j])
+		})
+		cur = parents[cur][0]
+	}
+
+	// The path goes against the direction of edges, so reverse it while rotating it to start from the least node
+	least := 0
+	for i := range path {
+		if less(path[i], path[least]) {
+			least = i
+		}
+	}
+
+	cycle := make([]Key, 0, len(path)+1)
+	for i := 0; i <= len(path); i++ {
+		cycle = append(cycle, keys[path[(least-i+len(path))%len(path)]])
+	}
+
+	return cycle
+}
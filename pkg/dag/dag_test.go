@@ -1,6 +1,15 @@
 package dag
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -198,3 +207,1144 @@ func TestDAG(t *testing.T) {
 		t.Fatalf("unexpected result: %v", res)
 	}
 }
+
+func TestDAG_Orderings(t *testing.T) {
+	var (
+		a = key("a")
+		b = key("b")
+		c = key("c")
+		d = key("d")
+	)
+
+	g := New(Nodes([]Key{a, b, c, d}))
+	g.AddDependency(c, a)
+	g.AddDependency(d, b)
+
+	orders, err := g.Orderings(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var actual []string
+	for _, o := range orders {
+		actual = append(actual, strings.Join(KeysToStringSlice(o), ","))
+	}
+
+	expected := []string{
+		"a,b,c,d",
+		"a,b,d,c",
+		"a,c,b,d",
+		"b,a,c,d",
+		"b,a,d,c",
+		"b,d,a,c",
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected result: expected=%v, got=%v", expected, actual)
+	}
+
+	orders, err = g.Orderings(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(orders); n != 2 {
+		t.Errorf("unexpected number of orderings: expected=2, got=%d", n)
+	}
+
+	count, err := g.CountOrderings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count.Int64() != 6 {
+		t.Errorf("unexpected count: expected=6, got=%v", count)
+	}
+
+	seen := map[string]int{}
+	for seed := int64(0); seed < 300; seed++ {
+		o, err := g.RandomOrder(seed)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[strings.Join(KeysToStringSlice(o), ",")]++
+	}
+
+	for _, e := range expected {
+		if seen[e] == 0 {
+			t.Errorf("ordering %q was never chosen: %v", e, seen)
+		}
+	}
+	if len(seen) != len(expected) {
+		t.Errorf("unexpected orderings chosen: %v", seen)
+	}
+
+	g.AddDependency(a, c)
+
+	if _, err := g.CountOrderings(); err == nil || err.Error() != "cycle detected: a -> c -> a" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Placeholders are ordered along with the nodes, keeping the constraints through them
+	g = New(UndefinedDependencies(PlaceholderForUndefined))
+	g.AddNodes(a, b)
+	g.AddEdge(a, key("x"))
+	g.AddEdge(key("x"), b)
+
+	orders, err = g.Orderings(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual = nil
+	for _, o := range orders {
+		actual = append(actual, strings.Join(KeysToStringSlice(o), ","))
+	}
+
+	if expected := []string{"a,x,b"}; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected result: expected=%v, got=%v", expected, actual)
+	}
+
+	if count, err := g.CountOrderings(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if count.Int64() != 1 {
+		t.Errorf("unexpected count: expected=1, got=%v", count)
+	}
+
+	if o, err := g.RandomOrder(0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if actual := strings.Join(KeysToStringSlice(o), ","); actual != "a,x,b" {
+		t.Errorf("unexpected result: expected=%q, got=%q", "a,x,b", actual)
+	}
+}
+
+func TestDAG_TransitiveReduction(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		db  = key("db")
+		net = key("net")
+	)
+
+	g := New()
+	g.Add(web, Dependencies(api, db, net), Labels([]string{"tier:web"}))
+	g.Add(api, Dependencies(db, net))
+	g.Add(db, Dependencies(net))
+	g.Add(net)
+
+	redundant, err := g.RedundantEdges()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var actual []string
+	for _, e := range redundant {
+		actual = append(actual, e.String())
+	}
+
+	expected := []string{
+		"db -> web is implied by db -> api -> web",
+		"net -> api is implied by net -> db -> api",
+		"net -> web is implied by net -> api -> web",
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected result: expected=%v, got=%v", expected, actual)
+	}
+
+	r, err := g.TransitiveReduction()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := &bytes.Buffer{}
+	if err := r.WriteDotTo(w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedDot := `digraph DAG {
+rankdir="LR"
+"api" [shape=record, label="{api}"]
+"db" [shape=record, label="{db}"]
+"net" [shape=record, label="{net}"]
+"web" [shape=record, label="{web|{tier:web}}"]
+"api" -> "web"
+"db" -> "api"
+"net" -> "db"
+}
+`
+	if actualDot := w.String(); actualDot != expectedDot {
+		t.Errorf("unexpected result: expected=%q, got=%q", expectedDot, actualDot)
+	}
+
+	res, err := r.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "net -> db -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestDAG_TransitiveOptions(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		ext = key("ext")
+	)
+
+	// The resulting graphs are created with the options of the original graph
+	g := New(UndefinedDependencies(PlaceholderForUndefined), ThreadSafe())
+	g.Add(web, Dependencies(api, ext))
+	g.Add(api, Dependencies(ext))
+
+	r, err := g.TransitiveReduction()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err := g.TransitiveClosure()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		g        *DAG
+		expected string
+	}{
+		{"reduction", r, "[ext -> api] [api -> web] []"},
+		{"closure", c, "[ext -> api ext -> web] [api -> web] []"},
+	} {
+		if tc.g.mu == nil {
+			t.Errorf("%s: expected the graph to be thread-safe", tc.name)
+		}
+
+		res, err := tc.g.Sort()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if !res[0][0].Placeholder {
+			t.Errorf("%s: expected ext to be a placeholder", tc.name)
+		}
+
+		var actual []string
+		for _, group := range res {
+			var edges []string
+			for _, n := range group {
+				for _, child := range n.ChildIds {
+					edges = append(edges, fmt.Sprintf("%s -> %s", n.Id, child))
+				}
+			}
+			sort.Strings(edges)
+			actual = append(actual, fmt.Sprintf("[%s]", strings.Join(edges, " ")))
+		}
+
+		if actual := strings.Join(actual, " "); actual != tc.expected {
+			t.Errorf("%s: unexpected result: expected=%q, got=%q", tc.name, tc.expected, actual)
+		}
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		var (
+			a = key("a")
+			b = key("b")
+			x = key("x")
+		)
+
+		// a -> x -> b doesn't imply a -> b, as the edges from and to the undefined x are dropped by Sort
+		g := New(UndefinedDependencies(DropUndefined), Warnings(func(error) {}))
+		g.AddNodes(a, b)
+		g.AddEdge(a, x)
+		g.AddEdge(x, b)
+		g.AddEdge(a, b)
+
+		redundant, err := g.RedundantEdges()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(redundant) != 0 {
+			t.Errorf("unexpected redundant edges: %v", redundant)
+		}
+
+		r, err := g.TransitiveReduction()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		c, err := g.TransitiveClosure()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		g.RemoveEdge(a, b)
+
+		cc, err := g.TransitiveClosure()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, tc := range []struct {
+			name     string
+			g        *DAG
+			expected string
+		}{
+			{"reduction", r, "a -> b"},
+			{"closure", c, "a -> b"},
+			{"closure without a -> b", cc, "a, b"},
+		} {
+			res, err := tc.g.Sort()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.name, err)
+			}
+
+			if actual := res.String(); actual != tc.expected {
+				t.Errorf("%s: unexpected result: expected=%q, got=%q", tc.name, tc.expected, actual)
+			}
+		}
+	})
+}
+
+func TestDAG_TransitiveClosure(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		db  = key("db")
+		net = key("net")
+	)
+
+	g := New()
+	g.Add(web, Dependencies(api))
+	g.Add(api, Dependencies(db))
+	g.Add(db, Dependencies(net))
+	g.Add(net, Labels([]string{"tier:net"}))
+
+	c, err := g.TransitiveClosure()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := &bytes.Buffer{}
+	if err := c.WriteDotTo(w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `digraph DAG {
+rankdir="LR"
+"api" [shape=record, label="{api}"]
+"db" [shape=record, label="{db}"]
+"net" [shape=record, label="{net|{tier:net}}"]
+"web" [shape=record, label="{web}"]
+"api" -> "web"
+"db" -> "api"
+"db" -> "web"
+"net" -> "api"
+"net" -> "db"
+"net" -> "web"
+}
+`
+	if actual := w.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	if !g.Reachable(net, web) {
+		t.Errorf("expected web to be reachable from net")
+	}
+
+	if g.Reachable(web, net) {
+		t.Errorf("expected net not to be reachable from web")
+	}
+
+	if g.Reachable(net, net) {
+		t.Errorf("expected net not to be reachable from itself")
+	}
+
+	g.RemoveEdge(db, api)
+
+	if g.Reachable(net, web) {
+		t.Errorf("expected web not to be reachable from net after removing the edge")
+	}
+
+	g.AddEdge(db, net)
+
+	if !g.Reachable(net, net) {
+		t.Errorf("expected net to be reachable from itself via the cycle")
+	}
+
+	// Edges to and from undefined nodes are followed only when Sort includes them as placeholders
+	var (
+		a = key("a")
+		b = key("b")
+		x = key("x")
+	)
+
+	for _, tc := range []struct {
+		policy   UndefinedDependencyPolicy
+		expected bool
+	}{
+		{DropUndefined, false},
+		{PlaceholderForUndefined, true},
+	} {
+		g := New(UndefinedDependencies(tc.policy), Warnings(func(error) {}))
+		g.AddNodes(a, b)
+		g.AddEdge(a, x)
+		g.AddEdge(x, b)
+
+		if actual := g.Reachable(a, b); actual != tc.expected {
+			t.Errorf("unexpected reachability with policy %d: expected=%v, got=%v", tc.policy, tc.expected, actual)
+		}
+
+		g.AddNode(x)
+
+		if !g.Reachable(a, b) {
+			t.Errorf("expected b to be reachable from a once x is added with policy %d", tc.policy)
+		}
+	}
+}
+
+func TestDAG_ThreadSafe(t *testing.T) {
+	g := New(ThreadSafe())
+
+	net := key("net")
+	g.Add(net)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				k := key(fmt.Sprintf("app%d-%d", i, j))
+
+				g.Add(k, Dependencies(net), Labels([]string{"tier:app"}))
+				g.AddLabel(k, "loaded")
+
+				if _, err := g.Sort(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				if err := g.WriteDotTo(ioutil.Discard); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				if !g.Reachable(net, k) {
+					t.Errorf("expected %v to be reachable from net", k)
+				}
+
+				c := g.Clone()
+				c.RemoveEdge(net, k)
+
+				if s := g.Subgraph(net, k); s.mu == nil {
+					t.Errorf("expected the subgraph to be thread-safe")
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	res, err := g.Sort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n := len(res); n != 2 {
+		t.Fatalf("unexpected number of groups: expected=2, got=%d", n)
+	}
+
+	if n := len(res[1]); n != 8*20 {
+		t.Errorf("unexpected number of nodes depending on net: expected=%d, got=%d", 8*20, n)
+	}
+
+	// Reachable only reads the graph, so concurrent lookups are safe even without ThreadSafe
+	plain, keys := newBenchmarkGraph(100)
+
+	// Compute the expected results on a clone, so that the lookups below populate the cache of plain concurrently
+	expected := map[Key]bool{}
+	for _, k := range keys {
+		expected[k] = plain.Clone().Reachable(keys[0], k)
+	}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := range keys {
+				k := keys[(i+j)%len(keys)]
+				if actual := plain.Reachable(keys[0], k); actual != expected[k] {
+					t.Errorf("unexpected reachability of %v: expected=%v, got=%v", k, expected[k], actual)
+				}
+				_ = plain.Reachable(k, keys[len(keys)-1])
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestDAG_Incremental(t *testing.T) {
+	var keys []Key
+	for i := 0; i < 12; i++ {
+		keys = append(keys, key(fmt.Sprintf("n%02d", i)))
+	}
+
+	full := New(Nodes(keys))
+	inc := New(Nodes(keys), Incremental())
+
+	rnd := rand.New(rand.NewSource(1))
+
+	// last is the last result of the incremental sort, which must be kept intact by later changes
+	var (
+		last     Topology
+		lastDump string
+	)
+
+	for i := 0; i < 500; i++ {
+		if actual := dumpTopology(last); actual != lastDump {
+			t.Fatalf("unexpected change to the previous result at step %d: expected=%s, got=%s", i, lastDump, actual)
+		}
+
+		if i%50 == 49 {
+			// Add a node now and then, so that it is placed into the cached result
+			k := key(fmt.Sprintf("n%02d", len(keys)))
+			keys = append(keys, k)
+			full.AddNode(k)
+			inc.AddNode(k)
+		}
+
+		i1, i2 := rnd.Intn(len(keys)), rnd.Intn(len(keys))
+
+		op := rnd.Intn(10)
+
+		// Mostly add forward edges so that the graph stays acyclic, with occasional ones introducing cycles
+		if i1 > i2 && op != 0 {
+			i1, i2 = i2, i1
+		}
+
+		from, to := keys[i1], keys[i2]
+
+		switch {
+		case op < 6:
+			if full.outputs[from][to] {
+				continue
+			}
+			full.AddEdge(from, to)
+			inc.AddEdge(from, to)
+		default:
+			if !full.outputs[from][to] {
+				continue
+			}
+			full.RemoveEdge(from, to)
+			inc.RemoveEdge(from, to)
+		}
+
+		expected, expectedErr := full.Sort()
+		actual, actualErr := inc.Sort()
+
+		if !reflect.DeepEqual(expectedErr, actualErr) {
+			t.Fatalf("unexpected error at step %d: expected=%v, got=%v", i, expectedErr, actualErr)
+		}
+
+		if expectedErr != nil {
+			// Undo the edge that introduced the cycle to see if the incremental state recovers
+			full.RemoveEdge(from, to)
+			inc.RemoveEdge(from, to)
+			continue
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("unexpected result at step %d: expected=%s, got=%s", i, dumpTopology(expected), dumpTopology(actual))
+		}
+
+		last, lastDump = actual, dumpTopology(actual)
+
+		expected, _ = full.Sort(Only(from), WithDependencies())
+		actual, _ = inc.Sort(Only(from), WithDependencies())
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("unexpected result with Only at step %d: expected=%s, got=%s", i, dumpTopology(expected), dumpTopology(actual))
+		}
+	}
+}
+
+// dumpTopology formats every NodeInfo in the topology for comparing results in failure messages
+func dumpTopology(t Topology) string {
+	var groups []string
+
+	for _, group := range t {
+		var infos []string
+		for _, n := range group {
+			infos = append(infos, fmt.Sprintf("%s p=%v c=%v", n.Id, n.ParentIds, n.ChildIds))
+		}
+		groups = append(groups, "["+strings.Join(infos, ", ")+"]")
+	}
+
+	return strings.Join(groups, " -> ")
+}
+
+// newBenchmarkGraph returns a graph of n nodes, each depending on up to 3 of the preceding nodes
+func newBenchmarkGraph(n int, opts ...Option) (*DAG, []Key) {
+	rnd := rand.New(rand.NewSource(1))
+
+	keys := make([]Key, n)
+	for i := range keys {
+		keys[i] = key(fmt.Sprintf("node%06d", i))
+	}
+
+	g := New(append([]Option{Nodes(keys)}, opts...)...)
+
+	for i := 1; i < n; i++ {
+		deps := map[Key]bool{}
+		for j := 0; j < 3; j++ {
+			deps[keys[rnd.Intn(i)]] = true
+		}
+		for d := range deps {
+			g.AddDependency(keys[i], d)
+		}
+	}
+
+	return g, keys
+}
+
+func benchmarkSort(b *testing.B, n int, opts func(keys []Key) []SortOption) {
+	g, keys := newBenchmarkGraph(n)
+
+	var o []SortOption
+	if opts != nil {
+		o = opts(keys)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Sort(o...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSort_10k(b *testing.B) {
+	benchmarkSort(b, 10000, nil)
+}
+
+func BenchmarkSort_100k(b *testing.B) {
+	benchmarkSort(b, 100000, nil)
+}
+
+// benchmarkEdgeChurn measures sorting the graph after each addition and removal of an edge
+func benchmarkEdgeChurn(b *testing.B, n int, opts ...Option) {
+	g, keys := newBenchmarkGraph(n, opts...)
+
+	rnd := rand.New(rand.NewSource(2))
+
+	if _, err := g.Sort(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Add a forward edge so that the graph stays acyclic
+		from := rnd.Intn(n - 1)
+		to := from + 1 + rnd.Intn(n-from-1)
+
+		if g.outputs[keys[from]][keys[to]] {
+			continue
+		}
+
+		g.AddEdge(keys[from], keys[to])
+
+		if _, err := g.Sort(); err != nil {
+			b.Fatal(err)
+		}
+
+		g.RemoveEdge(keys[from], keys[to])
+
+		if _, err := g.Sort(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEdgeChurn_50k(b *testing.B) {
+	benchmarkEdgeChurn(b, 50000)
+}
+
+func BenchmarkEdgeChurn_50k_Incremental(b *testing.B) {
+	benchmarkEdgeChurn(b, 50000, Incremental())
+}
+
+func BenchmarkSort_10k_Only(b *testing.B) {
+	benchmarkSort(b, 10000, func(keys []Key) []SortOption {
+		return []SortOption{Only(keys[len(keys)/2:]...), WithDependencies()}
+	})
+}
+
+func BenchmarkSort_100k_Only(b *testing.B) {
+	benchmarkSort(b, 100000, func(keys []Key) []SortOption {
+		return []SortOption{Only(keys[len(keys)/2:]...), WithDependencies()}
+	})
+}
+
+func TestDAG_NodeRegistry(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		net = key("net")
+	)
+
+	g := New()
+
+	if !g.AddNode(net) {
+		t.Errorf("expected net to be added")
+	}
+
+	if g.AddNode(net) {
+		t.Errorf("expected net not to be added twice")
+	}
+
+	if g.AddNodes(api, net, web) {
+		t.Errorf("expected AddNodes to report the already added node")
+	}
+
+	g.AddDependency(web, api, net)
+	g.AddDependency(web, api)
+	g.AddDependency(api, net)
+
+	res, err := g.Sort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "net -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	if g.RemoveEdge(web, api) {
+		t.Errorf("expected removing the nonexistent edge to fail")
+	}
+
+	if !g.RemoveEdge(api, web) {
+		t.Errorf("expected removing the edge to succeed")
+	}
+
+	res, err = g.Sort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "net -> api, web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestDAG_Strict(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		net = key("net")
+	)
+
+	g := New(Strict(), Nodes([]Key{api, net}))
+
+	if err := g.AddEdgeE(net, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := g.AddDependencyE(web, api)
+	if expected := `cannot add edge api -> web: undefined node "web"`; err == nil || err.Error() != expected {
+		t.Fatalf("unexpected error: expected=%q, got=%v", expected, err)
+	}
+
+	if ude, ok := err.(*UndefinedNodeError); !ok || ude.Node != web {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+
+	if g.AddEdge(key("db"), api) {
+		t.Errorf("expected the edge from the undefined node to be rejected")
+	}
+
+	if !g.Add(web, Dependencies(api, net)) {
+		t.Errorf("expected web to be added along with its dependencies")
+	}
+
+	res, err := g.Sort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "net -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestDAG_UndefinedDependencies(t *testing.T) {
+	var (
+		web = key("web")
+		api = key("api")
+		net = key("net")
+	)
+
+	build := func(opts ...Option) *DAG {
+		g := New(opts...)
+		g.AddNode(web)
+		g.AddNode(api)
+		g.AddEdge(api, web)
+		g.AddEdge(net, api)
+		return g
+	}
+
+	if _, err := build().Sort(); err == nil {
+		t.Fatalf("expected an undefined dependency error")
+	} else if _, ok := err.(*UndefinedDependencyError); !ok {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	t.Run("placeholder", func(t *testing.T) {
+		g := build(UndefinedDependencies(PlaceholderForUndefined), Incremental())
+
+		res, err := g.Sort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected, actual := "net -> api -> web", res.String(); actual != expected {
+			t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+		}
+
+		if !res[0][0].Placeholder || res[1][0].Placeholder {
+			t.Errorf("expected only net to be a placeholder")
+		}
+
+		var buf bytes.Buffer
+		if err := g.WriteDotTo(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected := `"net" [shape=record, label="{net}", style="dashed"]`; !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+		}
+
+		if expected := `"net" -> "api"`; !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+		}
+
+		g.AddNode(net)
+
+		res, err = g.Sort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if res[0][0].Placeholder {
+			t.Errorf("expected net not to be a placeholder once added")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		var warnings []error
+
+		g := build(UndefinedDependencies(DropUndefined), Warnings(func(err error) {
+			warnings = append(warnings, err)
+		}))
+
+		res, err := g.Sort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected, actual := "api -> web", res.String(); actual != expected {
+			t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+		}
+
+		if len(warnings) != 1 {
+			t.Fatalf("unexpected number of warnings: %v", warnings)
+		}
+
+		if ude, ok := warnings[0].(*UndefinedDependencyError); !ok || ude.UndefinedNode != net {
+			t.Errorf("unexpected warning: %v(%T)", warnings[0], warnings[0])
+		}
+	})
+
+	t.Run("dependent", func(t *testing.T) {
+		// A node that is never added but depends on other nodes is undefined as well
+		build := func(opts ...Option) *DAG {
+			g := New(opts...)
+			g.AddNode(api)
+			g.AddDependency(web, api)
+			return g
+		}
+
+		_, err := build().Sort()
+
+		expected := &UndefinedDependentError{UndefinedNode: web, Dependencies: []Key{api}}
+		if !reflect.DeepEqual(expected, err) {
+			t.Fatalf("unexpected error: expected=%v, got=%v(%T)", expected, err, err)
+		}
+
+		if expected, actual := `undefined node "web" depends on node(s): api`, err.Error(); actual != expected {
+			t.Errorf("unexpected error message: expected=%q, got=%q", expected, actual)
+		}
+
+		res, err := build(UndefinedDependencies(PlaceholderForUndefined)).Sort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected, actual := "api -> web", res.String(); actual != expected {
+			t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+		}
+
+		if !res[1][0].Placeholder {
+			t.Errorf("expected web to be a placeholder")
+		}
+
+		var warnings []error
+
+		res, err = build(UndefinedDependencies(DropUndefined), Warnings(func(err error) {
+			warnings = append(warnings, err)
+		})).Sort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected, actual := "api", res.String(); actual != expected {
+			t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+		}
+
+		if len(warnings) != 1 || !reflect.DeepEqual(warnings[0], expected) {
+			t.Errorf("unexpected warnings: %v", warnings)
+		}
+	})
+}
+
+func TestDAG_Validate(t *testing.T) {
+	g := New()
+
+	for _, n := range []string{"a", "b", "c", "d", "e", "f", "lonely"} {
+		g.AddNode(key(n))
+	}
+
+	// a -> b -> c -> a and d -> e -> d
+	g.AddEdge(key("a"), key("b"))
+	g.AddEdge(key("b"), key("c"))
+	g.AddEdge(key("c"), key("a"))
+	g.AddEdge(key("d"), key("e"))
+	g.AddEdge(key("e"), key("d"))
+
+	g.AddEdge(key("f"), key("f"))
+
+	// Dependents are reported in the order of Key.Less rather than the order of edges
+	g.AddEdge(key("undefined"), key("f"))
+	g.AddEdge(key("undefined"), key("a"))
+	g.AddEdge(key("e"), key("typo"))
+
+	g.AddEdge(key("a"), key("b"))
+
+	var actual []string
+	for _, err := range g.Validate() {
+		actual = append(actual, fmt.Sprintf("%T: %v", err, err))
+	}
+
+	expected := []string{
+		`*dag.Error: cycle detected: a -> b -> c -> a`,
+		`*dag.Error: cycle detected: d -> e -> d`,
+		`*dag.SelfLoopError: self-loop detected: node "f" depends on itself`,
+		`*dag.UndefinedDependentError: undefined node "typo" depends on node(s): e`,
+		`*dag.UndefinedDependencyError: undefined node "undefined" is depended by node(s): a, f`,
+		`*dag.DuplicateEdgeError: edge a -> b is added more than once`,
+		`*dag.IsolatedNodeError: node "lonely" is isolated: it neither depends on nor is depended by any node`,
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	g.RemoveEdge(key("a"), key("b"))
+	g.RemoveEdge(key("e"), key("d"))
+	g.RemoveEdge(key("f"), key("f"))
+	g.RemoveEdge(key("undefined"), key("f"))
+	g.RemoveEdge(key("undefined"), key("a"))
+	g.RemoveEdge(key("e"), key("typo"))
+	g.AddEdge(key("lonely"), key("f"))
+
+	if errs := g.Validate(); errs != nil {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestDAG_SelfLoop(t *testing.T) {
+	var (
+		a = key("a")
+		b = key("b")
+		c = key("c")
+	)
+
+	for _, opts := range [][]Option{nil, {Incremental()}} {
+		g := New(opts...)
+		g.AddNodes(a, b, c)
+
+		// The self-loop is reported in favor of the cycle involving the lesser node
+		g.AddEdge(a, b)
+		g.AddEdge(b, a)
+		g.AddEdge(c, c)
+
+		_, err := g.Sort()
+
+		sle, ok := err.(*SelfLoopError)
+		if !ok {
+			t.Fatalf("unexpected error: %v(%T)", err, err)
+		}
+
+		if sle.Node != c {
+			t.Errorf("unexpected result: expected=%q, got=%q", c, sle.Node)
+		}
+
+		if expected, actual := `self-loop detected: node "c" depends on itself`, err.Error(); actual != expected {
+			t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+		}
+	}
+}
+
+func TestDAG_ErrorsIs(t *testing.T) {
+	var (
+		a = key("a")
+		b = key("b")
+	)
+
+	g := New(Nodes([]Key{a, b}))
+	g.AddEdge(a, b)
+	g.AddEdge(b, a)
+
+	if _, err := g.Sort(); !errors.Is(err, ErrCycle) || errors.Is(err, ErrUndefined) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Nodes([]Key{a}))
+	g.AddEdge(a, a)
+
+	if _, err := g.Sort(); !errors.Is(err, ErrCycle) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Nodes([]Key{a}))
+	g.AddEdge(b, a)
+
+	if _, err := g.Sort(); !errors.Is(err, ErrUndefined) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+
+	if err := New(Strict()).AddEdgeE(a, b); !errors.Is(err, ErrUndefined) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Nodes([]Key{a, b}))
+	g.AddEdge(a, b)
+
+	if _, err := g.Sort(Only(b)); !errors.Is(err, ErrUnhandled) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+}
+
+func TestDAG_JSON(t *testing.T) {
+	codec := KeyCodecFuncs{
+		Encode: func(k Key) (string, error) {
+			r := k.(helmReleaseKey)
+			return strings.Join([]string{r.context, r.namespace, r.name}, "/"), nil
+		},
+		Decode: func(s string) (Key, error) {
+			parts := strings.Split(s, "/")
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("expected context/namespace/name")
+			}
+			return helmReleaseKey{context: parts[0], namespace: parts[1], name: parts[2]}, nil
+		},
+	}
+
+	web := helmReleaseKey{context: "prod", namespace: "apps", name: "web"}
+	api := helmReleaseKey{context: "prod", namespace: "apps", name: "api"}
+	db := helmReleaseKey{context: "prod", namespace: "data", name: "db"}
+
+	g := New()
+	g.AddNodes(web, api)
+	g.AddLabel(web, "tier:web")
+	g.AddDependency(web, api)
+	// An undefined dependency is preserved as is
+	g.AddDependency(api, db)
+
+	var buf bytes.Buffer
+	if err := g.WriteJSONTo(&buf, codec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err := ReadJSON(&buf, codec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d := Diff(g, c); !d.Empty() {
+		t.Errorf("unexpected difference after round-trip:\n%s", d)
+	}
+
+	if _, err := c.Sort(); !errors.Is(err, ErrUndefined) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = ReadJSON(strings.NewReader(`{"version":1,"nodes":[{"id":"web"}],"edges":[]}`), codec)
+	if expected := `decoding node "web": expected context/namespace/name`; err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected=%q, got=%v", expected, err)
+	}
+}
+
+func TestDAG_WriteMermaidTo_Placeholder(t *testing.T) {
+	g := New(UndefinedDependencies(PlaceholderForUndefined))
+	g.AddNode(key("api"))
+	g.AddDependency(key("api"), key("net"))
+
+	var buf bytes.Buffer
+	if err := g.WriteMermaidTo(&buf, GroupByLevel()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `flowchart LR
+  subgraph level0["Level 0"]
+    n1["net"]
+  end
+  subgraph level1["Level 1"]
+    n0["api"]
+  end
+  n1 --> n0
+  style n1 stroke-dasharray: 5 5
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestDAG_WriteDotTo_Backslash(t *testing.T) {
+	g := New()
+	g.Add(key(`a\`))
+	g.Add(key(`b"\`), Dependencies(key(`a\`)), Labels([]string{`x\`}))
+
+	var buf bytes.Buffer
+	if err := g.WriteDotTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Backslashes right before double quotes are doubled so that they don't escape the quotes
+	expected := `digraph DAG {
+rankdir="LR"
+"a\\" [shape=record, label="{a\\}"]
+"b\"\\" [shape=record, label="{b\"\\|{x\\}}"]
+"a\\" -> "b\"\\"
+}
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
@@ -0,0 +1,252 @@
+package dag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LabelChange is the change to labels of a node that exists in both graphs being compared
+type LabelChange struct {
+	Node    Key
+	Added   []string
+	Removed []string
+}
+
+// GraphDiff is the structural difference between two graphs, as returned by Diff.
+//
+// Every slice is ordered by Key.Less, comparing From and then To for edges.
+type GraphDiff struct {
+	AddedNodes    []Key
+	RemovedNodes  []Key
+	AddedEdges    []Edge
+	RemovedEdges  []Edge
+	ChangedLabels []LabelChange
+
+	a, b *DAG
+}
+
+// Diff returns the changes needed to turn graph a into graph b
+func Diff(a, b *DAG) *GraphDiff {
+	// Snapshot the graphs as the diff keeps referring to them for rendering
+	a, b = a.Clone(), b.Clone()
+
+	d := &GraphDiff{a: a, b: b}
+
+	aNodes, bNodes := nodeSet(a), nodeSet(b)
+
+	for _, n := range sortedKeys(bNodes) {
+		if !aNodes[n] {
+			d.AddedNodes = append(d.AddedNodes, n)
+		}
+	}
+
+	for _, n := range sortedKeys(aNodes) {
+		if !bNodes[n] {
+			d.RemovedNodes = append(d.RemovedNodes, n)
+			continue
+		}
+
+		var c LabelChange
+		for _, l := range sortedLabels(b.labels[n]) {
+			if !a.labels[n][l] {
+				c.Added = append(c.Added, l)
+			}
+		}
+		for _, l := range sortedLabels(a.labels[n]) {
+			if !b.labels[n][l] {
+				c.Removed = append(c.Removed, l)
+			}
+		}
+		if len(c.Added) > 0 || len(c.Removed) > 0 {
+			c.Node = n
+			d.ChangedLabels = append(d.ChangedLabels, c)
+		}
+	}
+
+	d.AddedEdges = edgesMissingIn(b, a)
+	d.RemovedEdges = edgesMissingIn(a, b)
+
+	return d
+}
+
+func nodeSet(g *DAG) map[Key]bool {
+	set := make(map[Key]bool, len(g.nodes))
+	for _, n := range g.nodes {
+		set[n] = true
+	}
+	return set
+}
+
+// edgesMissingIn returns the edges of g that other doesn't have
+func edgesMissingIn(g, other *DAG) []Edge {
+	var edges []Edge
+
+	for from, tos := range g.outputs {
+		for to := range tos {
+			if !other.outputs[from][to] {
+				edges = append(edges, Edge{From: from, To: to})
+			}
+		}
+	}
+
+	sortEdges(edges)
+
+	return edges
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From.Less(edges[j].From)
+		}
+		return edges[i].To.Less(edges[j].To)
+	})
+}
+
+// Empty returns true when the two graphs are structurally the same
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 &&
+		len(d.ChangedLabels) == 0
+}
+
+// String returns the diff in the text format written by WriteTextTo
+func (d *GraphDiff) String() string {
+	var b strings.Builder
+	_ = d.WriteTextTo(&b)
+	return b.String()
+}
+
+// WriteTextTo writes the diff line by line, e.g. "+ node web", "- edge cache -> web" and
+// "~ labels api: +tier:api -tier:db", prefixing additions with "+", removals with "-" and label changes with "~".
+func (d *GraphDiff) WriteTextTo(w io.Writer) error {
+	for _, n := range d.AddedNodes {
+		if _, err := fmt.Fprintf(w, "+ node %s\n", n); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range d.RemovedNodes {
+		if _, err := fmt.Fprintf(w, "- node %s\n", n); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range d.AddedEdges {
+		if _, err := fmt.Fprintf(w, "+ edge %s\n", e); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range d.RemovedEdges {
+		if _, err := fmt.Fprintf(w, "- edge %s\n", e); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range d.ChangedLabels {
+		var changes []string
+		for _, l := range c.Added {
+			changes = append(changes, "+"+l)
+		}
+		for _, l := range c.Removed {
+			changes = append(changes, "-"+l)
+		}
+		if _, err := fmt.Fprintf(w, "~ labels %s: %s\n", c.Node, strings.Join(changes, " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const (
+	diffAddedColor   = `color="green"`
+	diffRemovedColor = `color="red"`
+	diffChangedColor = `color="orange"`
+)
+
+// WriteDotTo writes both graphs merged into one in the same format as DAG.WriteDotTo,
+// coloring added nodes and edges green, removed ones red, and nodes whose labels changed orange.
+//
+// Removed elements are also dashed so that the diff is readable without colors.
+// Nodes are rendered with their labels in the new graph, or in the old graph for removed nodes.
+func (d *GraphDiff) WriteDotTo(w io.Writer) error {
+	fmt.Fprintln(w, "digraph DAG {\nrankdir=\"LR\"")
+
+	ctx := newDot(w, nil)
+
+	added := map[Key]bool{}
+	for _, n := range d.AddedNodes {
+		added[n] = true
+	}
+
+	removed := map[Key]bool{}
+	for _, n := range d.RemovedNodes {
+		removed[n] = true
+	}
+
+	changed := map[Key]bool{}
+	for _, c := range d.ChangedLabels {
+		changed[c.Node] = true
+	}
+
+	all := nodeSet(d.b)
+	for n := range removed {
+		all[n] = true
+	}
+
+	for _, n := range sortedKeys(all) {
+		var err error
+
+		switch {
+		case added[n]:
+			err = ctx.writeNode(n, d.b.labels[n], diffAddedColor)
+		case removed[n]:
+			err = ctx.writeNode(n, d.a.labels[n], diffRemovedColor, `style="dashed"`)
+		case changed[n]:
+			err = ctx.writeNode(n, d.b.labels[n], diffChangedColor)
+		default:
+			err = ctx.writeNode(n, d.b.labels[n])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	addedEdges := map[Edge]bool{}
+	for _, e := range d.AddedEdges {
+		addedEdges[e] = true
+	}
+
+	edges := append([]Edge{}, d.RemovedEdges...)
+	for from, tos := range d.b.outputs {
+		for to := range tos {
+			edges = append(edges, Edge{From: from, To: to})
+		}
+	}
+	sortEdges(edges)
+
+	for _, e := range edges {
+		var err error
+
+		switch {
+		case addedEdges[e]:
+			err = ctx.writeEdge(e.From, e.To, diffAddedColor)
+		case !d.b.outputs[e.From][e.To]:
+			err = ctx.writeEdge(e.From, e.To, diffRemovedColor, `style="dashed"`)
+		default:
+			err = ctx.writeEdge(e.From, e.To)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
@@ -7,14 +7,80 @@ import (
 	"strings"
 )
 
-func (d *DAG) WriteDotTo(w io.Writer) error {
-	fmt.Fprintln(w, "digraph DAG {\nrankdir=\"LR\"")
+type DotOption func(*DotOpts)
 
-	ctx := &dot{
-		writer:      w,
-		nodeWritten: make(map[Key]bool),
-		edgeWritten: make(map[edge]bool),
+type DotOpts struct {
+	rankDir       string
+	shape         string
+	labelAttrs    map[string][]string
+	clusterPrefix string
+	highlight     map[Key]bool
+}
+
+// RankDir sets the direction of the graph layout, which is one of "TB", "LR", "BT" and "RL". Defaults to "LR".
+func RankDir(dir string) DotOption {
+	return func(o *DotOpts) {
+		o.rankDir = dir
+	}
+}
+
+// NodeShape sets the shape of nodes. Defaults to "record", which renders labels in separate fields.
+// With any other shape, labels are rendered in lines below the name of the node.
+func NodeShape(shape string) DotOption {
+	return func(o *DotOpts) {
+		o.shape = shape
+	}
+}
+
+// LabelStyle adds the DOT attributes like `color="blue"` and `style="filled"` to the nodes having the label.
+// When a node has multiple styled labels, the attributes are added in the order of the labels.
+func LabelStyle(label string, attrs ...string) DotOption {
+	return func(o *DotOpts) {
+		if o.labelAttrs == nil {
+			o.labelAttrs = map[string][]string{}
+		}
+		o.labelAttrs[label] = append(o.labelAttrs[label], attrs...)
+	}
+}
+
+// ClusterByLabelPrefix groups nodes into a cluster per value of the label having the prefix,
+// e.g. "tier:" makes clusters named "api" and "db" for nodes labeled "tier:api" and "tier:db".
+// A node having multiple such labels belongs to the cluster of the least one.
+func ClusterByLabelPrefix(prefix string) DotOption {
+	return func(o *DotOpts) {
+		o.clusterPrefix = prefix
+	}
+}
+
+// Highlight renders the nodes and the edges between them in bold red
+func Highlight(keys ...Key) DotOption {
+	return func(o *DotOpts) {
+		if o.highlight == nil {
+			o.highlight = map[Key]bool{}
+		}
+		for _, k := range keys {
+			o.highlight[k] = true
+		}
 	}
+}
+
+const dotHighlightAttrs = `color="red", penwidth=2`
+
+// WriteDotTo writes the graph in the Graphviz DOT language with the default options of WriteDot
+func (d *DAG) WriteDotTo(w io.Writer) error {
+	return d.WriteDot(w)
+}
+
+// WriteDot writes the graph in the Graphviz DOT language, rendering each node with its labels.
+//
+// Nodes and edges are written in the order of Key.Less, so that the output is stable.
+func (d *DAG) WriteDot(w io.Writer, opts ...DotOption) error {
+	d.rlock()
+	defer d.runlock()
+
+	ctx := newDot(w, opts)
+
+	fmt.Fprintf(w, "digraph DAG {\nrankdir=%s\n", dotQuote(ctx.opts.rankDir))
 
 	nodes := make([]Key, len(d.nodes))
 	for i, n := range d.nodes {
@@ -24,13 +90,44 @@ func (d *DAG) WriteDotTo(w io.Writer) error {
 		return nodes[i].Less(nodes[j])
 	})
 
+	clusters := map[string][]Key{}
+	var topLevel []Key
+
 	for _, n := range nodes {
+		if c, ok := ctx.clusterOf(d.labels[n]); ok {
+			clusters[c] = append(clusters[c], n)
+		} else {
+			topLevel = append(topLevel, n)
+		}
+	}
+
+	for _, c := range sortedLabels(setOf(clusters)) {
+		fmt.Fprintf(w, "subgraph %s {\nlabel=%s\n", dotQuote("cluster_"+c), dotQuote(c))
+		for _, n := range clusters[c] {
+			if err := ctx.writeNode(n, d.labels[n]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, "}"); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range topLevel {
 		if err := ctx.writeNode(n, d.labels[n]); err != nil {
 			return err
 		}
 	}
 
-	for _, from := range nodes {
+	placeholders := d.placeholders()
+
+	for _, n := range placeholders {
+		if err := ctx.writeNode(n, nil, `style="dashed"`); err != nil {
+			return err
+		}
+	}
+
+	for _, from := range append(nodes, placeholders...) {
 		outs, ok := d.outputs[from]
 		if !ok {
 			continue
@@ -46,7 +143,11 @@ func (d *DAG) WriteDotTo(w io.Writer) error {
 		})
 
 		for _, to := range tos {
-			if err := ctx.writeEdge(from, to); err != nil {
+			var attrs []string
+			if ctx.opts.highlight[from] && ctx.opts.highlight[to] {
+				attrs = append(attrs, dotHighlightAttrs)
+			}
+			if err := ctx.writeEdge(from, to, attrs...); err != nil {
 				return err
 			}
 		}
@@ -56,17 +157,56 @@ func (d *DAG) WriteDotTo(w io.Writer) error {
 	return err
 }
 
+func setOf(m map[string][]Key) map[string]bool {
+	set := make(map[string]bool, len(m))
+	for k := range m {
+		set[k] = true
+	}
+	return set
+}
+
 type dot struct {
 	writer      io.Writer
+	opts        DotOpts
 	nodeWritten map[Key]bool
 	edgeWritten map[edge]bool
 }
 
+func newDot(w io.Writer, opts []DotOption) *dot {
+	c := &dot{
+		writer:      w,
+		opts:        DotOpts{rankDir: "LR", shape: "record"},
+		nodeWritten: make(map[Key]bool),
+		edgeWritten: make(map[edge]bool),
+	}
+
+	for _, o := range opts {
+		o(&c.opts)
+	}
+
+	return c
+}
+
+// clusterOf returns the name of the cluster of the node having the labels
+func (c *dot) clusterOf(labels map[string]bool) (string, bool) {
+	if c.opts.clusterPrefix == "" {
+		return "", false
+	}
+
+	for _, l := range sortedLabels(labels) {
+		if strings.HasPrefix(l, c.opts.clusterPrefix) {
+			return strings.TrimPrefix(l, c.opts.clusterPrefix), true
+		}
+	}
+
+	return "", false
+}
+
 type edge struct {
 	from, to interface{}
 }
 
-func (c *dot) writeNode(v Key, labels map[string]bool) error {
+func (c *dot) writeNode(v Key, labels map[string]bool, attrs ...string) error {
 	if c.nodeWritten[v] {
 		return nil
 	}
@@ -79,22 +219,164 @@ func (c *dot) writeNode(v Key, labels map[string]bool) error {
 		sort.Strings(ls)
 	}
 
+	name := fmt.Sprintf("%s", v)
+
 	var label string
-	if len(ls) > 0 {
-		label = fmt.Sprintf("{%s|{%s}}", v, strings.Join(ls, "|"))
+	if c.opts.shape != "record" {
+		lines := []string{escapeDotLabel(name)}
+		for _, l := range ls {
+			lines = append(lines, escapeDotLabel(l))
+		}
+		label = strings.Join(lines, `\n`)
+	} else if len(ls) > 0 {
+		fields := make([]string, len(ls))
+		for i, l := range ls {
+			fields[i] = escapeRecordField(l)
+		}
+		label = fmt.Sprintf("{%s|{%s}}", escapeRecordField(name), strings.Join(fields, "|"))
 	} else {
-		label = fmt.Sprintf("{%s}", v)
+		label = fmt.Sprintf("{%s}", escapeRecordField(name))
+	}
+
+	for _, l := range ls {
+		attrs = append(attrs, c.opts.labelAttrs[l]...)
 	}
 
-	_, err := fmt.Fprintf(c.writer, `%q [shape=record, label=%q]`+"\n", v, label)
+	if c.opts.highlight[v] {
+		attrs = append(attrs, dotHighlightAttrs)
+	}
+
+	_, err := fmt.Fprintf(c.writer, `%s [shape=%s, label=%s%s]`+"\n", dotQuote(name), c.opts.shape, dotQuote(label), joinAttrs(attrs))
 	return err
 }
 
-func (c *dot) writeEdge(from, to Key) error {
+func (c *dot) writeEdge(from, to Key, attrs ...string) error {
 	if c.edgeWritten[edge{from, to}] {
 		return nil
 	}
 	c.edgeWritten[edge{from, to}] = true
-	_, err := fmt.Fprintf(c.writer, `%q -> %q`+"\n", from, to)
+	f, t := dotQuote(fmt.Sprintf("%s", from)), dotQuote(fmt.Sprintf("%s", to))
+	if len(attrs) == 0 {
+		_, err := fmt.Fprintf(c.writer, `%s -> %s`+"\n", f, t)
+		return err
+	}
+	_, err := fmt.Fprintf(c.writer, `%s -> %s [%s]`+"\n", f, t, strings.Join(attrs, ", "))
+	return err
+}
+
+// joinAttrs formats additional attributes to be appended to the attribute list of a node
+func joinAttrs(attrs []string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(attrs, ", ")
+}
+
+// dotQuote quotes the string as a DOT string, in which only double quotes need escaping.
+// Unlike Go's %q, backslashes are kept as they are so that escapes in record and plain labels reach Graphviz,
+// except that the ones right before a double quote, including the closing one, are doubled
+// so that e.g. the key `a\` is written as "a\\" rather than "a\" that leaves the string open.
+func dotQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	// backslashes is the number of backslashes written right before the current character
+	backslashes := 0
+
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteRune(r)
+			backslashes++
+			continue
+		case '"':
+			b.WriteString(strings.Repeat(`\`, backslashes))
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteRune(r)
+		}
+		backslashes = 0
+	}
+
+	b.WriteString(strings.Repeat(`\`, backslashes))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// escapeRecordField escapes the characters that have special meanings in record labels
+func escapeRecordField(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "{", `\{`, "}", `\}`, "<", `\<`, ">", `\>`).Replace(s)
+}
+
+// escapeDotLabel escapes backslashes in a plain label, which would otherwise start escape sequences like \n
+func escapeDotLabel(s string) string {
+	return strings.Replace(s, `\`, `\\`, -1)
+}
+
+// WriteDotTo writes the topology in the Graphviz DOT language, aligning the nodes of each level with rank=same
+// and drawing edges from ParentIds, so that the picture shows which nodes are processed in parallel.
+//
+// Edges from nodes not included in the topology, like the dependencies excluded by WithoutDependencies, are omitted.
+func (r Topology) WriteDotTo(w io.Writer) error {
+	ctx := newDot(w, nil)
+
+	fmt.Fprintf(w, "digraph DAG {\nrankdir=%s\n", dotQuote(ctx.opts.rankDir))
+
+	included := map[Key]bool{}
+	levels := make([][]*NodeInfo, len(r))
+
+	for i, set := range r {
+		levels[i] = append([]*NodeInfo{}, set...)
+		sort.Slice(levels[i], func(j, k int) bool {
+			return levels[i][j].Id.Less(levels[i][k].Id)
+		})
+
+		for _, n := range set {
+			included[n.Id] = true
+		}
+	}
+
+	for _, level := range levels {
+		ids := make([]string, len(level))
+
+		for i, n := range level {
+			var attrs []string
+			if n.Placeholder {
+				attrs = append(attrs, `style="dashed"`)
+			}
+			if err := ctx.writeNode(n.Id, nil, attrs...); err != nil {
+				return err
+			}
+			ids[i] = dotQuote(fmt.Sprintf("%s", n.Id))
+		}
+
+		if _, err := fmt.Fprintf(w, "{rank=same; %s}\n", strings.Join(ids, "; ")); err != nil {
+			return err
+		}
+	}
+
+	for _, level := range levels {
+		for _, n := range level {
+			parents := append([]Key{}, n.ParentIds...)
+			sort.Slice(parents, func(i, j int) bool {
+				return parents[i].Less(parents[j])
+			})
+
+			for _, p := range parents {
+				if !included[p] {
+					continue
+				}
+				if err := ctx.writeEdge(p, n.Id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
 	return err
 }
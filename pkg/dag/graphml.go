@@ -0,0 +1,144 @@
+package dag
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is a node to be written in an XML-based format, along with the attributes shared by the formats
+type xmlNode struct {
+	id     string
+	labels string
+	level  int
+}
+
+// xmlGraph returns the nodes in the order of the result of Sort and the edges between them,
+// with every key formatted by fmt's %s.
+func (g *DAG) xmlGraph() ([]xmlNode, [][2]string, error) {
+	g.rlock()
+	defer g.runlock()
+
+	res, err := g.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		nodes []xmlNode
+		edges [][2]string
+	)
+
+	included := map[Key]bool{}
+	for _, set := range res {
+		for _, n := range set {
+			included[n.Id] = true
+		}
+	}
+
+	for level, set := range res {
+		for _, n := range set {
+			nodes = append(nodes, xmlNode{
+				id:     sprintKey(n.Id),
+				labels: strings.Join(sortedLabels(g.labels[n.Id]), "|"),
+				level:  level,
+			})
+		}
+	}
+
+	for _, set := range res {
+		for _, n := range set {
+			for _, to := range sortedKeys(g.outputs[n.Id]) {
+				if included[to] {
+					edges = append(edges, [2]string{sprintKey(n.Id), sprintKey(to)})
+				}
+			}
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteGraphMLTo writes the graph in GraphML, which is read by tools like yEd.
+//
+// Every node has the "labels" attribute joined by "|" and the "level" attribute, which is the index of the group
+// containing the node in the result of Sort. It returns the same error as Sort when the graph can't be sorted.
+func (g *DAG) WriteGraphMLTo(w io.Writer) error {
+	nodes, edges, err := g.xmlGraph()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="labels" for="node" attr.name="labels" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="level" for="node" attr.name="level" attr.type="int"/>` + "\n")
+	b.WriteString(`  <graph id="DAG" edgedefault="directed">` + "\n")
+
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", xmlEscape(n.id))
+		fmt.Fprintf(&b, "      <data key=\"labels\">%s</data>\n", xmlEscape(n.labels))
+		fmt.Fprintf(&b, "      <data key=\"level\">%d</data>\n", n.level)
+		b.WriteString("    </node>\n")
+	}
+
+	for _, e := range edges {
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\"/>\n", xmlEscape(e[0]), xmlEscape(e[1]))
+	}
+
+	b.WriteString("  </graph>\n</graphml>\n")
+
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// WriteGEXFTo writes the graph in GEXF 1.3, which is read by tools like Gephi,
+// with the same "labels" and "level" attributes as WriteGraphMLTo.
+func (g *DAG) WriteGEXFTo(w io.Writer) error {
+	nodes, edges, err := g.xmlGraph()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	b.WriteString(`  <graph defaultedgetype="directed">` + "\n")
+	b.WriteString(`    <attributes class="node">` + "\n")
+	b.WriteString(`      <attribute id="labels" title="labels" type="string"/>` + "\n")
+	b.WriteString(`      <attribute id="level" title="level" type="integer"/>` + "\n")
+	b.WriteString("    </attributes>\n")
+	b.WriteString("    <nodes>\n")
+
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "      <node id=\"%s\" label=\"%s\">\n", xmlEscape(n.id), xmlEscape(n.id))
+		b.WriteString("        <attvalues>\n")
+		fmt.Fprintf(&b, "          <attvalue for=\"labels\" value=\"%s\"/>\n", xmlEscape(n.labels))
+		fmt.Fprintf(&b, "          <attvalue for=\"level\" value=\"%d\"/>\n", n.level)
+		b.WriteString("        </attvalues>\n")
+		b.WriteString("      </node>\n")
+	}
+
+	b.WriteString("    </nodes>\n")
+	b.WriteString("    <edges>\n")
+
+	for i, e := range edges {
+		fmt.Fprintf(&b, "      <edge id=\"%d\" source=\"%s\" target=\"%s\"/>\n", i, xmlEscape(e[0]), xmlEscape(e[1]))
+	}
+
+	b.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+
+	_, err = b.WriteTo(w)
+	return err
+}
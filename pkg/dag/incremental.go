@@ -0,0 +1,328 @@
+package dag
+
+import (
+	"sort"
+	"sync"
+)
+
+// Incremental makes the graph maintain the depth of every node as nodes and edges are added or removed,
+// so that Sort doesn't need to traverse the whole graph after every change.
+//
+// Adding an edge only revisits the nodes whose depths increase, and removing an edge only the nodes whose
+// depths decrease. The result of Sort is cached, and only the nodes affected by a change are updated in it
+// on the next call to Sort. NodeInfos are shared between the results of Sort, so callers must not modify them.
+//
+// Whenever a change can't be applied incrementally, like adding an edge that introduces a cycle or
+// referring to an undefined node, the graph falls back to a full sort on the next call to Sort,
+// and resumes incremental maintenance once the graph becomes valid again.
+func Incremental() Option {
+	return func(g *DAG) {
+		g.inc = &incrementalState{}
+	}
+}
+
+type incrementalState struct {
+	// mu guards updates to the state made by Sort, which may run concurrently under the read lock
+	mu sync.Mutex
+
+	// valid is false when the state needs to be rebuilt by a full sort
+	valid bool
+
+	// levels is the depth of the node at each index
+	levels []int
+	// parents is the reverse of DAG.children, used to recompute the depth of a node after an edge is removed
+	parents [][]int
+
+	// groups is the result of the last sort, which is patched rather than rebuilt after changes.
+	// Groups and NodeInfos in it are replaced rather than modified, as they are shared with the results of Sort.
+	groups Topology
+	// ids is the indices of the nodes in each group of groups, replaced along with the group
+	ids [][]int
+	// placed is the index of the group containing the node at each index in groups, or -1 when it is not there yet
+	placed []int
+	// dirty is the set of nodes whose NodeInfos in groups are outdated
+	dirty map[int]bool
+}
+
+func (s *incrementalState) invalidate() {
+	s.valid = false
+	s.levels = nil
+	s.parents = nil
+	s.groups = nil
+	s.ids = nil
+	s.placed = nil
+	s.dirty = nil
+}
+
+// grow extends the state to cover the keys allocated since it is built
+func (s *incrementalState) grow(g *DAG) {
+	for len(s.levels) < len(g.keys) {
+		s.levels = append(s.levels, 0)
+		s.parents = append(s.parents, nil)
+		s.placed = append(s.placed, -1)
+	}
+}
+
+// levelChanged marks the nodes whose NodeInfos are affected by the change of the depth of the node
+func (s *incrementalState) levelChanged(g *DAG, i int) {
+	s.dirty[i] = true
+
+	// Parents are ordered by their depths
+	for _, j := range g.children[i] {
+		s.dirty[j] = true
+	}
+}
+
+// nodeAdded updates the depths after key is added to g.nodes
+func (s *incrementalState) nodeAdded(g *DAG, key Key) {
+	if !s.valid {
+		return
+	}
+
+	i := g.ids[key]
+
+	if len(g.children[i]) > 0 || g.numInputs[i] > 0 {
+		// The node has been referenced by edges before it is added
+		s.invalidate()
+		return
+	}
+
+	s.grow(g)
+	s.levels[i] = 0
+	s.dirty[i] = true
+}
+
+// edgeAdded updates the depths after the edge from -> to is added
+func (s *incrementalState) edgeAdded(g *DAG, from, to Key) {
+	if !s.valid {
+		return
+	}
+
+	i, j := g.ids[from], g.ids[to]
+
+	if i == j || !g.defined[i] || !g.defined[j] {
+		s.invalidate()
+		return
+	}
+
+	s.parents[j] = append(s.parents[j], i)
+	s.dirty[i] = true
+	s.dirty[j] = true
+
+	if s.levels[j] > s.levels[i] {
+		return
+	}
+
+	s.levels[j] = s.levels[i] + 1
+	s.levelChanged(g, j)
+
+	// Push the new depth down to the dependents.
+	// Reaching `from` means that the new edge closed a cycle.
+	queue := []int{j}
+	for len(queue) > 0 {
+		var cur int
+		cur, queue = queue[0], queue[1:]
+
+		for _, next := range g.children[cur] {
+			if next == i {
+				s.invalidate()
+				return
+			}
+
+			if s.levels[next] <= s.levels[cur] {
+				s.levels[next] = s.levels[cur] + 1
+				s.levelChanged(g, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+// edgeRemoved updates the depths after the edge from -> to is removed
+func (s *incrementalState) edgeRemoved(g *DAG, from, to Key) {
+	if !s.valid {
+		return
+	}
+
+	i, j := g.ids[from], g.ids[to]
+
+	for k, p := range s.parents[j] {
+		if p == i {
+			s.parents[j] = append(s.parents[j][:k], s.parents[j][k+1:]...)
+			break
+		}
+	}
+
+	s.dirty[i] = true
+	s.dirty[j] = true
+
+	// Pull the depths of the dependents up until they no longer change
+	queue := []int{j}
+	for len(queue) > 0 {
+		var cur int
+		cur, queue = queue[0], queue[1:]
+
+		level := 0
+		for _, p := range s.parents[cur] {
+			if l := s.levels[p] + 1; l > level {
+				level = l
+			}
+		}
+
+		if level == s.levels[cur] {
+			continue
+		}
+
+		s.levels[cur] = level
+		s.levelChanged(g, cur)
+
+		queue = append(queue, g.children[cur]...)
+	}
+}
+
+// incrementalGroups returns the same result as computeGroups, reusing the maintained depths when possible
+func (g *DAG) incrementalGroups() (Topology, [][]int, error) {
+	s := g.inc
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.valid {
+		groups, ids, err := g.computeGroups()
+		if err != nil {
+			return groups, ids, err
+		}
+
+		// Placeholders and dropped edges are resolved by every full sort rather than maintained incrementally
+		if g.hasUndefinedNodes() {
+			return groups, ids, nil
+		}
+
+		s.rebuild(g, groups, ids)
+	}
+
+	if len(s.dirty) > 0 {
+		s.patch(g)
+	}
+
+	return s.groups, s.ids, nil
+}
+
+// rebuild resets the depths from the result of a full sort
+func (s *incrementalState) rebuild(g *DAG, groups Topology, ids [][]int) {
+	s.valid = true
+	s.levels = make([]int, len(g.keys))
+	s.parents = make([][]int, len(g.keys))
+	s.placed = make([]int, len(g.keys))
+	s.dirty = map[int]bool{}
+
+	for i := range s.placed {
+		s.placed[i] = -1
+	}
+
+	for level, group := range ids {
+		for _, i := range group {
+			s.levels[i] = level
+			s.placed[i] = level
+		}
+	}
+
+	for i, children := range g.children {
+		for _, j := range children {
+			s.parents[j] = append(s.parents[j], i)
+		}
+	}
+
+	s.groups = groups
+	s.ids = ids
+}
+
+// patch replaces the NodeInfos of the dirty nodes in groups, moving them to the groups of their current depths
+func (s *incrementalState) patch(g *DAG) {
+	ranks := g.keyRanks()
+
+	groups := append(Topology{}, s.groups...)
+	ids := append([][]int{}, s.ids...)
+	copied := map[int]bool{}
+
+	// group returns the level whose group and indices are copied on the first call,
+	// so that previous results are kept intact
+	group := func(level int) int {
+		for len(groups) <= level {
+			groups = append(groups, nil)
+			ids = append(ids, nil)
+		}
+
+		if !copied[level] {
+			groups[level] = append([]*NodeInfo(nil), groups[level]...)
+			ids[level] = append([]int(nil), ids[level]...)
+			copied[level] = true
+		}
+
+		return level
+	}
+
+	// position returns where the node is, or is to be inserted, in the group ordered by Key.Less
+	position := func(level, i int) int {
+		set := ids[level]
+		return sort.Search(len(set), func(k int) bool {
+			return ranks[set[k]] >= ranks[i]
+		})
+	}
+
+	for i := range s.dirty {
+		info := &NodeInfo{
+			Id:        g.keys[i],
+			ParentIds: s.parentIds(g, ranks, i),
+			ChildIds:  g.keysOf(g.children[i]),
+		}
+
+		level := s.levels[i]
+
+		if old := s.placed[i]; old == level {
+			groups[group(level)][position(level, i)] = info
+			continue
+		} else if old >= 0 {
+			k := position(group(old), i)
+			groups[old] = append(groups[old][:k], groups[old][k+1:]...)
+			ids[old] = append(ids[old][:k], ids[old][k+1:]...)
+		}
+
+		k := position(group(level), i)
+
+		groups[level] = append(groups[level], nil)
+		copy(groups[level][k+1:], groups[level][k:])
+		groups[level][k] = info
+
+		ids[level] = append(ids[level], 0)
+		copy(ids[level][k+1:], ids[level][k:])
+		ids[level][k] = i
+
+		s.placed[i] = level
+	}
+
+	// Nodes only leave the deepest groups, as every node at a depth depends on a node at the previous depth
+	for len(groups) > 0 && len(groups[len(groups)-1]) == 0 {
+		groups = groups[:len(groups)-1]
+		ids = ids[:len(ids)-1]
+	}
+
+	s.groups = groups
+	s.ids = ids
+	s.dirty = map[int]bool{}
+}
+
+// parentIds returns the parents of the node in the same order as computeGroups does,
+// i.e. ordered by their depths and then by Key.Less.
+func (s *incrementalState) parentIds(g *DAG, ranks []int, i int) []Key {
+	ps := append([]int(nil), s.parents[i]...)
+
+	sort.Slice(ps, func(a, b int) bool {
+		if s.levels[ps[a]] != s.levels[ps[b]] {
+			return s.levels[ps[a]] < s.levels[ps[b]]
+		}
+		return ranks[ps[a]] < ranks[ps[b]]
+	})
+
+	return g.keysOf(ps)
+}
@@ -0,0 +1,146 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONSchemaVersion is the version of the JSON document written by WriteJSONTo.
+// It is bumped whenever the document changes in a way that older readers can't handle.
+const JSONSchemaVersion = 1
+
+// KeyCodec converts keys to and from the strings that identify nodes in serialized graphs.
+type KeyCodec interface {
+	EncodeKey(Key) (string, error)
+	DecodeKey(string) (Key, error)
+}
+
+// KeyCodecFuncs is a KeyCodec made of a pair of functions
+type KeyCodecFuncs struct {
+	Encode func(Key) (string, error)
+	Decode func(string) (Key, error)
+}
+
+func (c KeyCodecFuncs) EncodeKey(k Key) (string, error) {
+	return c.Encode(k)
+}
+
+func (c KeyCodecFuncs) DecodeKey(s string) (Key, error) {
+	return c.Decode(s)
+}
+
+// jsonGraph is the JSON document of a graph, e.g.
+// {"version":1,"nodes":[{"id":"api","labels":["tier:api"]},{"id":"web"}],"edges":[{"from":"api","to":"web"}]}
+//
+// Edges from or to nodes that are not defined are kept, so that undefined dependencies survive a round-trip.
+type jsonGraph struct {
+	Version int        `json:"version"`
+	Nodes   []jsonNode `json:"nodes"`
+	Edges   []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	Id     string   `json:"id"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WriteJSONTo writes the nodes, edges and labels of the graph as a JSON document that can be read by ReadJSON.
+//
+// Nodes are written in the order of addition, and edges in the order of Key.Less of From and then To.
+func (g *DAG) WriteJSONTo(w io.Writer, codec KeyCodec) error {
+	g.rlock()
+	defer g.runlock()
+
+	doc := jsonGraph{
+		Version: JSONSchemaVersion,
+		Nodes:   []jsonNode{},
+		Edges:   []jsonEdge{},
+	}
+
+	for _, n := range g.nodes {
+		id, err := codec.EncodeKey(n)
+		if err != nil {
+			return fmt.Errorf("encoding node %q: %v", n, err)
+		}
+
+		doc.Nodes = append(doc.Nodes, jsonNode{Id: id, Labels: sortedLabels(g.labels[n])})
+	}
+
+	var edges []Edge
+	for from, tos := range g.outputs {
+		for to := range tos {
+			edges = append(edges, Edge{From: from, To: to})
+		}
+	}
+	sortEdges(edges)
+
+	for _, e := range edges {
+		from, err := codec.EncodeKey(e.From)
+		if err != nil {
+			return fmt.Errorf("encoding edge %s: %v", e, err)
+		}
+
+		to, err := codec.EncodeKey(e.To)
+		if err != nil {
+			return fmt.Errorf("encoding edge %s: %v", e, err)
+		}
+
+		doc.Edges = append(doc.Edges, jsonEdge{From: from, To: to})
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// ReadJSON returns a new graph created with the options from the JSON document written by WriteJSONTo.
+//
+// It fails when the document is of a schema version other than JSONSchemaVersion, or defines a node twice.
+func ReadJSON(r io.Reader, codec KeyCodec, opts ...Option) (*DAG, error) {
+	var doc jsonGraph
+
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Version != JSONSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d: expected %d", doc.Version, JSONSchemaVersion)
+	}
+
+	g := New(opts...)
+
+	for _, n := range doc.Nodes {
+		k, err := codec.DecodeKey(n.Id)
+		if err != nil {
+			return nil, fmt.Errorf("decoding node %q: %v", n.Id, err)
+		}
+
+		if !g.AddNode(k) {
+			return nil, fmt.Errorf("node %q is defined more than once", n.Id)
+		}
+
+		g.AddLabel(k, n.Labels...)
+	}
+
+	for _, e := range doc.Edges {
+		from, err := codec.DecodeKey(e.From)
+		if err != nil {
+			return nil, fmt.Errorf("decoding edge %s -> %s: %v", e.From, e.To, err)
+		}
+
+		to, err := codec.DecodeKey(e.To)
+		if err != nil {
+			return nil, fmt.Errorf("decoding edge %s -> %s: %v", e.From, e.To, err)
+		}
+
+		if err := g.AddEdgeE(from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,156 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type MergeOption func(*MergeOpts)
+
+type MergeOpts struct {
+	failOnDuplicateNode bool
+	failOnLabelConflict bool
+}
+
+// FailOnDuplicateNode makes Merge fail when a node is defined in two or more graphs
+func FailOnDuplicateNode() MergeOption {
+	return func(o *MergeOpts) {
+		o.failOnDuplicateNode = true
+	}
+}
+
+// FailOnLabelConflict makes Merge fail when a node is defined in two or more graphs with different labels.
+// Without this option, labels of the same node are unioned.
+func FailOnLabelConflict() MergeOption {
+	return func(o *MergeOpts) {
+		o.failOnLabelConflict = true
+	}
+}
+
+// MergeReport tells which of the merged graphs contributed each node, edge and label.
+// Graphs are identified by their indices in the arguments to Merge.
+type MergeReport struct {
+	Nodes  map[Key][]int
+	Edges  map[Edge][]int
+	Labels map[Key]map[string][]int
+}
+
+// MergeConflictError is returned by Merge when a node is defined in two graphs in a conflicting way
+type MergeConflictError struct {
+	Node Key
+
+	// Sources are the indices of the conflicting graphs
+	Sources [2]int
+
+	// Labels are the labels of the node in each of the conflicting graphs,
+	// only set when FailOnLabelConflict detected the conflict
+	Labels [2][]string
+}
+
+func (e *MergeConflictError) Error() string {
+	if e.Labels[0] == nil && e.Labels[1] == nil {
+		return fmt.Sprintf("node %q is defined in both graph %d and %d", e.Node, e.Sources[0], e.Sources[1])
+	}
+
+	return fmt.Sprintf(
+		"node %q is defined with different labels in graph %d and %d: [%s] and [%s]",
+		e.Node, e.Sources[0], e.Sources[1], strings.Join(e.Labels[0], ", "), strings.Join(e.Labels[1], ", "),
+	)
+}
+
+// Merge returns a new graph that is the union of nodes, edges and labels of the given graphs,
+// along with the report of which graph contributed what.
+func Merge(graphs ...*DAG) (*DAG, *MergeReport, error) {
+	return MergeWithOptions(graphs)
+}
+
+// MergeWithOptions is the same as Merge but accepts options for handling conflicts between graphs.
+func MergeWithOptions(graphs []*DAG, opt ...MergeOption) (*DAG, *MergeReport, error) {
+	opts := &MergeOpts{}
+	for _, o := range opt {
+		o(opts)
+	}
+
+	report := &MergeReport{
+		Nodes:  map[Key][]int{},
+		Edges:  map[Edge][]int{},
+		Labels: map[Key]map[string][]int{},
+	}
+
+	// definedLabels remembers the labels of each node as defined by the first graph that defined it
+	definedLabels := map[Key][]string{}
+
+	m := New()
+
+	for i, g := range graphs {
+		// Snapshot the graph so that we don't need to hold its lock while merging it
+		g = g.Clone()
+
+		defined := map[Key]bool{}
+
+		for _, n := range g.nodes {
+			if defined[n] {
+				continue
+			}
+			defined[n] = true
+
+			labels := sortedLabels(g.labels[n])
+
+			if sources := report.Nodes[n]; len(sources) > 0 {
+				first := sources[0]
+
+				if opts.failOnDuplicateNode {
+					return nil, nil, &MergeConflictError{Node: n, Sources: [2]int{first, i}}
+				}
+
+				if opts.failOnLabelConflict && strings.Join(definedLabels[n], "\n") != strings.Join(labels, "\n") {
+					return nil, nil, &MergeConflictError{
+						Node:    n,
+						Sources: [2]int{first, i},
+						Labels:  [2][]string{definedLabels[n], labels},
+					}
+				}
+			} else {
+				definedLabels[n] = labels
+				m.AddNode(n)
+			}
+
+			report.Nodes[n] = append(report.Nodes[n], i)
+		}
+
+		for _, n := range sortedKeys(defined) {
+			for _, l := range sortedLabels(g.labels[n]) {
+				m.AddLabel(n, l)
+
+				if report.Labels[n] == nil {
+					report.Labels[n] = map[string][]int{}
+				}
+				report.Labels[n][l] = append(report.Labels[n][l], i)
+			}
+		}
+
+		for from, tos := range g.outputs {
+			for to := range tos {
+				e := Edge{From: from, To: to}
+
+				if len(report.Edges[e]) == 0 {
+					m.AddEdge(from, to)
+				}
+
+				report.Edges[e] = append(report.Edges[e], i)
+			}
+		}
+	}
+
+	return m, report, nil
+}
+
+func sortedLabels(labels map[string]bool) []string {
+	ls := []string{}
+	for l := range labels {
+		ls = append(ls, l)
+	}
+	sort.Strings(ls)
+	return ls
+}
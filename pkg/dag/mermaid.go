@@ -0,0 +1,132 @@
+package dag
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type MermaidOption func(*MermaidOpts)
+
+type MermaidOpts struct {
+	levels bool
+}
+
+// GroupByLevel makes WriteMermaidTo put the nodes of each level of the result of Sort into a subgraph,
+// so that nodes that can be processed in parallel are rendered side by side.
+func GroupByLevel() MermaidOption {
+	return func(o *MermaidOpts) {
+		o.levels = true
+	}
+}
+
+// WriteMermaidTo writes the graph as a Mermaid flowchart, showing the labels of each node below its name.
+//
+// Nodes and edges are written in the order of Key.Less like WriteDotTo. Nodes are identified by their positions
+// in that order, as Mermaid IDs can't contain arbitrary characters.
+// With GroupByLevel, it returns the same error as Sort when the graph can't be sorted.
+func (g *DAG) WriteMermaidTo(w io.Writer, opts ...MermaidOption) error {
+	g.rlock()
+	defer g.runlock()
+
+	var o MermaidOpts
+	for _, f := range opts {
+		f(&o)
+	}
+
+	var levels Topology
+	if o.levels {
+		var err error
+		if levels, err = g.sort(); err != nil {
+			return err
+		}
+	}
+
+	placeholders := g.placeholders()
+
+	isPlaceholder := map[Key]bool{}
+	all := map[Key]bool{}
+
+	for _, n := range g.nodes {
+		all[n] = true
+	}
+	for _, n := range placeholders {
+		all[n] = true
+		isPlaceholder[n] = true
+	}
+	for from := range all {
+		for to := range g.outputs[from] {
+			all[to] = true
+		}
+	}
+
+	keys := sortedKeys(all)
+
+	ids := make(map[Key]string, len(keys))
+	for i, k := range keys {
+		ids[k] = fmt.Sprintf("n%d", i)
+	}
+
+	if _, err := fmt.Fprintln(w, "flowchart LR"); err != nil {
+		return err
+	}
+
+	writeNode := func(indent string, k Key) error {
+		text := mermaidEscape(fmt.Sprintf("%s", k))
+		if ls := sortedLabels(g.labels[k]); g.isDefined(k) && len(ls) > 0 {
+			text += "<br/>" + mermaidEscape(strings.Join(ls, ", "))
+		}
+		_, err := fmt.Fprintf(w, "%s%s[\"%s\"]\n", indent, ids[k], text)
+		return err
+	}
+
+	written := map[Key]bool{}
+
+	for i, level := range levels {
+		if _, err := fmt.Fprintf(w, "  subgraph level%d[\"Level %d\"]\n", i, i); err != nil {
+			return err
+		}
+		for _, n := range level {
+			if err := writeNode("    ", n.Id); err != nil {
+				return err
+			}
+			written[n.Id] = true
+		}
+		if _, err := fmt.Fprintln(w, "  end"); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range keys {
+		if written[k] {
+			continue
+		}
+		if err := writeNode("  ", k); err != nil {
+			return err
+		}
+	}
+
+	for _, from := range keys {
+		if !g.isDefined(from) && !isPlaceholder[from] {
+			continue
+		}
+		for _, to := range sortedKeys(g.outputs[from]) {
+			if _, err := fmt.Fprintf(w, "  %s --> %s\n", ids[from], ids[to]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, k := range placeholders {
+		if _, err := fmt.Fprintf(w, "  style %s stroke-dasharray: 5 5\n", ids[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mermaidEscape escapes characters that can't appear as they are in a quoted Mermaid node text
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,271 @@
+package dag
+
+import (
+	"math/big"
+	"math/rand"
+	"sort"
+)
+
+// orderings is an index-based snapshot of the graph used to enumerate, count and sample
+// linear topological orderings.
+//
+// Nodes, including placeholders for undefined nodes, are indexed in the order of Key.Less
+// so that every enumeration is deterministic.
+type orderings struct {
+	keys       []Key
+	children   [][]int
+	numParents []int
+
+	// counts memoizes the number of orderings that complete a given set of already-ordered nodes
+	counts map[string]*big.Int
+}
+
+func (g *DAG) newOrderings() (*orderings, error) {
+	g.rlock()
+	defer g.runlock()
+
+	// Let Sort report cycles and undefined dependencies so that we don't need to duplicate the checks
+	if _, err := g.sort(); err != nil {
+		return nil, err
+	}
+
+	// Placeholders are ordered like the other nodes, so that the constraints through them are kept
+	keys := append(g.sortedNodes(), g.placeholders()...)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Less(keys[j])
+	})
+
+	index := make(map[Key]int, len(keys))
+	for i, k := range keys {
+		index[k] = i
+	}
+
+	o := &orderings{
+		keys:       keys,
+		children:   make([][]int, len(keys)),
+		numParents: make([]int, len(keys)),
+		counts:     map[string]*big.Int{},
+	}
+
+	for i, from := range keys {
+		for to := range g.outputs[from] {
+			j, ok := index[to]
+			if !ok {
+				continue
+			}
+			o.children[i] = append(o.children[i], j)
+			o.numParents[j]++
+		}
+		sort.Ints(o.children[i])
+	}
+
+	return o, nil
+}
+
+// walk calls fn for each ordering in lexicographic order of node indices, until fn returns false or
+// limit orderings are visited.
+func (o *orderings) walk(limit int, fn func([]Key) bool) {
+	n := len(o.keys)
+
+	numParents := make([]int, n)
+	copy(numParents, o.numParents)
+
+	used := make([]bool, n)
+	order := make([]Key, 0, n)
+	visited := 0
+
+	var next func() bool
+	next = func() bool {
+		if len(order) == n {
+			visited++
+
+			res := make([]Key, n)
+			copy(res, order)
+
+			if !fn(res) {
+				return false
+			}
+
+			return limit <= 0 || visited < limit
+		}
+
+		for i := 0; i < n; i++ {
+			if used[i] || numParents[i] > 0 {
+				continue
+			}
+
+			used[i] = true
+			order = append(order, o.keys[i])
+			for _, c := range o.children[i] {
+				numParents[c]--
+			}
+
+			cont := next()
+
+			for _, c := range o.children[i] {
+				numParents[c]++
+			}
+			order = order[:len(order)-1]
+			used[i] = false
+
+			if !cont {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	next()
+}
+
+// count returns the number of orderings of the nodes not yet marked as used.
+// numParents must hold the number of unused dependencies of each node.
+func (o *orderings) count(used []bool, numParents []int) *big.Int {
+	memoKey := make([]byte, len(used))
+	remaining := 0
+	for i, u := range used {
+		if u {
+			memoKey[i] = 1
+		} else {
+			remaining++
+		}
+	}
+
+	if remaining <= 1 {
+		return big.NewInt(1)
+	}
+
+	if c, ok := o.counts[string(memoKey)]; ok {
+		return c
+	}
+
+	total := new(big.Int)
+
+	for i := range o.keys {
+		if used[i] || numParents[i] > 0 {
+			continue
+		}
+
+		used[i] = true
+		for _, c := range o.children[i] {
+			numParents[c]--
+		}
+
+		total.Add(total, o.count(used, numParents))
+
+		for _, c := range o.children[i] {
+			numParents[c]++
+		}
+		used[i] = false
+	}
+
+	o.counts[string(memoKey)] = total
+
+	return total
+}
+
+// WalkOrderings calls fn with each valid topological ordering of all the nodes, dependencies first.
+//
+// Orderings are visited in a deterministic order, comparing nodes with Key.Less.
+// Walking stops once fn returns false or limit orderings are visited. A non-positive limit means no limit.
+//
+// Placeholders for undefined nodes are ordered along with the other nodes, like Sort includes them.
+// It returns the same error as Sort when the graph contains a cycle or an undefined dependency.
+func (g *DAG) WalkOrderings(limit int, fn func(order []Key) bool) error {
+	o, err := g.newOrderings()
+	if err != nil {
+		return err
+	}
+
+	o.walk(limit, fn)
+
+	return nil
+}
+
+// Orderings returns up to limit valid topological orderings of all the nodes.
+// A non-positive limit means no limit, which is rarely what you want as the number of orderings
+// grows factorially with the number of independent nodes.
+func (g *DAG) Orderings(limit int) ([][]Key, error) {
+	var res [][]Key
+
+	err := g.WalkOrderings(limit, func(order []Key) bool {
+		res = append(res, order)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CountOrderings returns the number of valid topological orderings of all the nodes.
+//
+// The count is computed without enumerating the orderings, but it still takes time and memory
+// proportional to the number of sets of nodes that can be ordered first, which can be exponential
+// in the number of mutually independent nodes.
+func (g *DAG) CountOrderings() (*big.Int, error) {
+	o, err := g.newOrderings()
+	if err != nil {
+		return nil, err
+	}
+
+	numParents := make([]int, len(o.keys))
+	copy(numParents, o.numParents)
+
+	return new(big.Int).Set(o.count(make([]bool, len(o.keys)), numParents)), nil
+}
+
+// RandomOrder returns a valid topological ordering of all the nodes, chosen uniformly at random
+// among all the valid orderings.
+//
+// The same seed always results in the same ordering for the same graph.
+// See CountOrderings for the cost of the computation.
+func (g *DAG) RandomOrder(seed int64) ([]Key, error) {
+	o, err := g.newOrderings()
+	if err != nil {
+		return nil, err
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+
+	n := len(o.keys)
+
+	used := make([]bool, n)
+	numParents := make([]int, n)
+	copy(numParents, o.numParents)
+
+	order := make([]Key, 0, n)
+
+	for len(order) < n {
+		// Pick the next node with the probability proportional to the number of orderings starting with it,
+		// so that every complete ordering is equally likely.
+		r := new(big.Int).Rand(rnd, o.count(used, numParents))
+
+		for i := range o.keys {
+			if used[i] || numParents[i] > 0 {
+				continue
+			}
+
+			used[i] = true
+			for _, c := range o.children[i] {
+				numParents[c]--
+			}
+
+			c := o.count(used, numParents)
+			if r.Cmp(c) < 0 {
+				order = append(order, o.keys[i])
+				break
+			}
+			r.Sub(r, c)
+
+			for _, c := range o.children[i] {
+				numParents[c]++
+			}
+			used[i] = false
+		}
+	}
+
+	return order, nil
+}
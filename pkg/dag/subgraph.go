@@ -0,0 +1,63 @@
+package dag
+
+// Induced returns a new graph created with the same options as g, made of the nodes for which include returns true,
+// along with their labels and the edges between them.
+//
+// Unlike Sort with Only, dependencies of the included nodes are never implicitly added.
+// Edges to and from excluded nodes are dropped.
+func (g *DAG) Induced(include func(Key) bool) *DAG {
+	if g.mu != nil {
+		// Snapshot the graph so that include can safely call methods of the graph
+		g = g.Clone()
+	}
+
+	included := map[Key]bool{}
+
+	s := g.newLike(len(g.nodes))
+
+	for _, n := range g.nodes {
+		if _, ok := included[n]; ok {
+			continue
+		}
+
+		included[n] = include(n)
+
+		if !included[n] {
+			continue
+		}
+
+		s.AddNode(n)
+
+		for l := range g.labels[n] {
+			s.AddLabel(n, l)
+		}
+	}
+
+	for _, from := range g.nodes {
+		if !included[from] {
+			continue
+		}
+
+		for to := range g.outputs[from] {
+			if included[to] {
+				s.AddEdge(from, to)
+			}
+		}
+	}
+
+	return s
+}
+
+// Subgraph returns a new graph made of the given nodes, along with their labels and the edges between them.
+//
+// Keys that are not nodes of the graph are ignored.
+func (g *DAG) Subgraph(keys ...Key) *DAG {
+	set := make(map[Key]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+
+	return g.Induced(func(k Key) bool {
+		return set[k]
+	})
+}
@@ -0,0 +1,104 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var topologyKeyEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "->", `-\>`)
+
+func escapeTopologyKey(s string) string {
+	return topologyKeyEscaper.Replace(s)
+}
+
+// ParseTopology parses the string form of a topology returned by Topology.String into the names of nodes
+// in each group.
+func ParseTopology(s string) ([][]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var (
+		groups [][]string
+		group  []string
+		name   strings.Builder
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("invalid topology %q: trailing backslash", s)
+			}
+			i++
+			name.WriteByte(s[i])
+		case strings.HasPrefix(s[i:], ", "):
+			group = append(group, name.String())
+			name.Reset()
+			i++
+		case strings.HasPrefix(s[i:], " -> "):
+			groups = append(groups, append(group, name.String()))
+			group = nil
+			name.Reset()
+			i += 3
+		case s[i] == ',' || strings.HasPrefix(s[i:], "->"):
+			return nil, fmt.Errorf("invalid topology %q: unescaped %q at %d", s, s[i:i+1], i)
+		default:
+			name.WriteByte(s[i])
+		}
+	}
+
+	groups = append(groups, append(group, name.String()))
+
+	for _, g := range groups {
+		for _, n := range g {
+			if n == "" {
+				return nil, fmt.Errorf("invalid topology %q: empty node name", s)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// jsonNodeInfo is the JSON form of NodeInfo, with keys formatted by fmt's %s
+type jsonNodeInfo struct {
+	Id          string   `json:"id"`
+	ParentIds   []string `json:"parents"`
+	ChildIds    []string `json:"children"`
+	Placeholder bool     `json:"placeholder,omitempty"`
+}
+
+// MarshalJSON encodes the topology as an array of groups, each being an array of nodes with their ids,
+// parents and children formatted by fmt's %s, e.g. [[{"id":"net","parents":[],"children":["api"]}],...].
+// Nodes in each group are ordered by Key.Less.
+func (r Topology) MarshalJSON() ([]byte, error) {
+	groups := make([][]jsonNodeInfo, len(r))
+
+	for i, set := range r {
+		ids := make([]Key, len(set))
+		infos := make(map[Key]*NodeInfo, len(set))
+		for j, n := range set {
+			ids[j] = n.Id
+			infos[n.Id] = n
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i].Less(ids[j])
+		})
+
+		groups[i] = make([]jsonNodeInfo, len(ids))
+		for j, id := range ids {
+			n := infos[id]
+			groups[i][j] = jsonNodeInfo{
+				Id:          sprintKey(n.Id),
+				ParentIds:   append([]string{}, KeysToStringSlice(n.ParentIds)...),
+				ChildIds:    append([]string{}, KeysToStringSlice(n.ChildIds)...),
+				Placeholder: n.Placeholder,
+			}
+		}
+	}
+
+	return json.Marshal(groups)
+}
@@ -0,0 +1,256 @@
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RedundantEdge is an edge that is already implied by a longer path between the same nodes.
+type RedundantEdge struct {
+	From Key
+	To   Key
+
+	// Path is the longer path from From to To that makes the edge redundant, including both ends
+	Path []Key
+}
+
+func (e *RedundantEdge) String() string {
+	return fmt.Sprintf("%s -> %s is implied by %s", e.From, e.To, strings.Join(KeysToStringSlice(e.Path), " -> "))
+}
+
+// copyNodes returns a new graph that has the same options, nodes and labels as g but no edges.
+func (g *DAG) copyNodes() *DAG {
+	nodes := g.sortedNodes()
+
+	c := g.newLike(len(nodes))
+
+	for _, n := range nodes {
+		c.AddNode(n)
+	}
+
+	for n, labels := range g.labels {
+		for l := range labels {
+			c.AddLabel(n, l)
+		}
+	}
+
+	return c
+}
+
+// sources returns the set of nodes that Sort includes and that have one or more dependents Sort includes
+func (g *DAG) sources() map[Key]bool {
+	set := map[Key]bool{}
+	for i, children := range g.children {
+		if !g.isPresent(i) {
+			continue
+		}
+		for _, j := range children {
+			if g.isPresent(j) {
+				set[g.keys[i]] = true
+				break
+			}
+		}
+	}
+	return set
+}
+
+// presentOutputs returns the dependents of the node that Sort includes, or nil when Sort doesn't include the node.
+// Edges to and from the undefined nodes dropped by DropUndefined are ignored as Sort ignores them.
+func (g *DAG) presentOutputs(k Key) map[Key]bool {
+	i, ok := g.ids[k]
+	if !ok || !g.isPresent(i) {
+		return nil
+	}
+
+	set := map[Key]bool{}
+	for _, j := range g.children[i] {
+		if g.isPresent(j) {
+			set[g.keys[j]] = true
+		}
+	}
+	return set
+}
+
+// descendants returns every node reachable from each node through one or more edges that Sort takes into account.
+//
+// The graph must be acyclic.
+func (g *DAG) descendants() map[Key]map[Key]bool {
+	desc := map[Key]map[Key]bool{}
+
+	var visit func(k Key) map[Key]bool
+	visit = func(k Key) map[Key]bool {
+		if d, ok := desc[k]; ok {
+			return d
+		}
+
+		d := map[Key]bool{}
+		for c := range g.presentOutputs(k) {
+			d[c] = true
+			for cc := range visit(c) {
+				d[cc] = true
+			}
+		}
+		desc[k] = d
+
+		return d
+	}
+
+	// Visit placeholders as well, so that the closure keeps what Sort makes of them
+	for i, k := range g.keys {
+		if g.isPresent(i) {
+			visit(k)
+		}
+	}
+
+	return desc
+}
+
+// RedundantEdges returns every edge that is implied by a longer path between the same nodes,
+// ordered by Key.Less of From and then To.
+//
+// For example, when "web" depends on both "api" and "net" while "api" depends on "net",
+// the edge from "net" to "web" is redundant.
+//
+// It returns the same error as Sort when the graph contains a cycle or an undefined dependency.
+func (g *DAG) RedundantEdges() ([]*RedundantEdge, error) {
+	g.rlock()
+	defer g.runlock()
+
+	return g.redundantEdges()
+}
+
+func (g *DAG) redundantEdges() ([]*RedundantEdge, error) {
+	if _, err := g.sort(); err != nil {
+		return nil, err
+	}
+
+	desc := g.descendants()
+
+	var res []*RedundantEdge
+
+	// Undefined nodes are included as they may be placeholders
+	for _, from := range sortedKeys(g.sources()) {
+		children := sortedKeys(g.presentOutputs(from))
+
+		for _, to := range children {
+			for _, via := range children {
+				if via == to || !desc[via][to] {
+					continue
+				}
+
+				path := []Key{from, via}
+				for cur := via; cur != to; {
+					for _, next := range sortedKeys(g.presentOutputs(cur)) {
+						if next == to || desc[next][to] {
+							cur = next
+							break
+						}
+					}
+					path = append(path, cur)
+				}
+
+				res = append(res, &RedundantEdge{From: from, To: to, Path: path})
+
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// TransitiveReduction returns a new graph that has the same nodes, labels and reachability as g
+// but none of the redundant edges reported by RedundantEdges.
+func (g *DAG) TransitiveReduction() (*DAG, error) {
+	g.rlock()
+	defer g.runlock()
+
+	redundant, err := g.redundantEdges()
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[edge]bool{}
+	for _, e := range redundant {
+		skip[edge{e.From, e.To}] = true
+	}
+
+	r := g.copyNodes()
+
+	for from, tos := range g.outputs {
+		for to := range tos {
+			if skip[edge{from, to}] {
+				continue
+			}
+			r.AddEdge(from, to)
+		}
+	}
+
+	return r, nil
+}
+
+// TransitiveClosure returns a new graph that has the same nodes and labels as g,
+// with an edge from every node to each node reachable from it in g.
+//
+// It returns the same error as Sort when the graph contains a cycle or an undefined dependency.
+func (g *DAG) TransitiveClosure() (*DAG, error) {
+	g.rlock()
+	defer g.runlock()
+
+	if _, err := g.sort(); err != nil {
+		return nil, err
+	}
+
+	c := g.copyNodes()
+
+	for from, tos := range g.descendants() {
+		for to := range tos {
+			c.AddEdge(from, to)
+		}
+	}
+
+	return c, nil
+}
+
+// Reachable returns true when there is a path of one or more edges from one node to the other,
+// that is, when the latter depends on the former directly or transitively.
+//
+// Like Sort, it follows edges to and from undefined nodes only when they are placeholders.
+// The nodes reachable from a node are computed on the first call for the node and cached
+// until a node is added or an edge is added or removed, so that repeated lookups are cheap.
+func (g *DAG) Reachable(from, to Key) bool {
+	g.rlock()
+	defer g.runlock()
+
+	g.reachableMu.Lock()
+	r, ok := g.reachable[from]
+	g.reachableMu.Unlock()
+
+	if !ok {
+		r = map[Key]bool{}
+
+		// Follow only the edges Sort takes into account, skipping the undefined nodes dropped by DropUndefined
+		stack := []Key{from}
+		for len(stack) > 0 {
+			var cur Key
+			cur, stack = stack[len(stack)-1], stack[:len(stack)-1]
+
+			for next := range g.presentOutputs(cur) {
+				if r[next] {
+					continue
+				}
+				r[next] = true
+				stack = append(stack, next)
+			}
+		}
+
+		g.reachableMu.Lock()
+		if g.reachable == nil {
+			g.reachable = map[Key]map[Key]bool{}
+		}
+		g.reachable[from] = r
+		g.reachableMu.Unlock()
+	}
+
+	return r[to]
+}
@@ -0,0 +1,106 @@
+package dag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteTreeTo writes the topology as an indented tree of dependents drawn with box-drawing characters, e.g.
+//
+//	net
+//	├── api
+//	│   └── web
+//	└── web
+//
+// Every node without dependencies in the topology is a root. A node depended by multiple nodes is expanded
+// only at its first appearance, and marked with "(*)" at the others to keep the output proportional to the graph.
+func (r Topology) WriteTreeTo(w io.Writer) error {
+	nodes := map[Key]*NodeInfo{}
+	for _, set := range r {
+		for _, n := range set {
+			nodes[n.Id] = n
+		}
+	}
+
+	// children returns the dependents of the node included in the topology, ordered by Key.Less
+	children := func(n *NodeInfo) []Key {
+		var cs []Key
+		for _, c := range n.ChildIds {
+			if _, ok := nodes[c]; ok {
+				cs = append(cs, c)
+			}
+		}
+		sort.Slice(cs, func(i, j int) bool {
+			return cs[i].Less(cs[j])
+		})
+		return cs
+	}
+
+	var roots []Key
+	for k, n := range nodes {
+		root := true
+		for _, p := range n.ParentIds {
+			if _, ok := nodes[p]; ok {
+				root = false
+				break
+			}
+		}
+		if root {
+			roots = append(roots, k)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Less(roots[j])
+	})
+
+	expanded := map[Key]bool{}
+
+	var write func(k Key, prefix, branch, indent string) error
+	write = func(k Key, prefix, branch, indent string) error {
+		n := nodes[k]
+
+		cs := children(n)
+
+		if expanded[k] && len(cs) > 0 {
+			_, err := fmt.Fprintf(w, "%s%s%s (*)\n", prefix, branch, sprintKey(k))
+			return err
+		}
+		expanded[k] = true
+
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, branch, sprintKey(k)); err != nil {
+			return err
+		}
+
+		for i, c := range cs {
+			b, in := "├── ", "│   "
+			if i == len(cs)-1 {
+				b, in = "└── ", "    "
+			}
+			if err := write(c, prefix+indent, b, in); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, k := range roots {
+		if err := write(k, "", "", ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteTextTo writes the result of Sort as a tree, in the format of Topology.WriteTreeTo.
+// It returns the same error as Sort when the graph can't be sorted.
+func (g *DAG) WriteTextTo(w io.Writer) error {
+	res, err := g.Sort()
+	if err != nil {
+		return err
+	}
+
+	return res.WriteTreeTo(w)
+}
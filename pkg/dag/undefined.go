@@ -0,0 +1,145 @@
+package dag
+
+import (
+	"log"
+)
+
+// UndefinedDependencyPolicy selects how Sort handles a node that is referred to by edges but never added.
+type UndefinedDependencyPolicy int
+
+const (
+	// FailOnUndefined makes Sort return *UndefinedDependencyError, or *UndefinedDependentError
+	// when the undefined node only depends on other nodes. This is the default.
+	FailOnUndefined UndefinedDependencyPolicy = iota
+	// PlaceholderForUndefined makes Sort include the undefined node as an external node,
+	// marked by NodeInfo.Placeholder and rendered dashed by WriteDotTo.
+	PlaceholderForUndefined
+	// DropUndefined makes Sort ignore the edges from and to the undefined node,
+	// reporting them as *UndefinedDependencyError and *UndefinedDependentError to the function set by Warnings.
+	DropUndefined
+)
+
+// UndefinedDependencies selects how Sort handles dependencies on nodes that are never added to the graph.
+//
+// Unlike Strict, the policy is applied on every call to Sort, so that nodes can still be added after their dependents.
+func UndefinedDependencies(p UndefinedDependencyPolicy) Option {
+	return func(g *DAG) {
+		g.undefinedPolicy = p
+	}
+}
+
+// Warnings sets the function called with the problems the graph tolerates, like the edges dropped by DropUndefined.
+// Warnings are written to the standard logger by default.
+func Warnings(f func(error)) Option {
+	return func(g *DAG) {
+		g.warn = f
+	}
+}
+
+func (g *DAG) warnf(err error) {
+	if g.warn != nil {
+		g.warn(err)
+		return
+	}
+
+	log.Printf("warning: %v", err)
+}
+
+// presentNodes tells whether the key at each index is sorted, which depends on the undefined dependency policy.
+// It returns the first error for the first undefined node when the policy is FailOnUndefined.
+func (g *DAG) presentNodes() ([]bool, error) {
+	present := make([]bool, len(g.keys))
+	copy(present, g.defined)
+
+	for i := range g.keys {
+		if !g.isUndefined(i) {
+			continue
+		}
+
+		switch g.undefinedPolicy {
+		case PlaceholderForUndefined:
+			present[i] = true
+		case DropUndefined:
+			for _, err := range g.undefinedErrors(i) {
+				g.warnf(err)
+			}
+		default:
+			return nil, g.undefinedErrors(i)[0]
+		}
+	}
+
+	return present, nil
+}
+
+// isPresent returns true when Sort includes the key at the index under the undefined dependency policy.
+// Unlike presentNodes, it neither warns nor fails, for queries that follow the edges Sort takes into account.
+func (g *DAG) isPresent(i int) bool {
+	return g.defined[i] || g.undefinedPolicy == PlaceholderForUndefined && g.isUndefined(i)
+}
+
+// isUndefined returns true when the key at the index is referred to by edges but never added
+func (g *DAG) isUndefined(i int) bool {
+	return !g.defined[i] && (len(g.children[i]) > 0 || g.numInputs[i] > 0)
+}
+
+// undefinedErrors returns *UndefinedDependencyError when the undefined node at the index has dependents,
+// followed by *UndefinedDependentError when it has dependencies.
+func (g *DAG) undefinedErrors(i int) []error {
+	var errs []error
+
+	if len(g.children[i]) > 0 {
+		children := append([]int(nil), g.children[i]...)
+		g.sortIds(children)
+
+		errs = append(errs, &UndefinedDependencyError{
+			UndefinedNode: g.keys[i],
+			Dependents:    g.keysOf(children),
+		})
+	}
+
+	if g.numInputs[i] > 0 {
+		var parents []int
+		for j, children := range g.children {
+			for _, c := range children {
+				if c == i {
+					parents = append(parents, j)
+				}
+			}
+		}
+		g.sortIds(parents)
+
+		errs = append(errs, &UndefinedDependentError{
+			UndefinedNode: g.keys[i],
+			Dependencies:  g.keysOf(parents),
+		})
+	}
+
+	return errs
+}
+
+// placeholders returns the undefined nodes that Sort includes as placeholders, ordered by Key.Less
+func (g *DAG) placeholders() []Key {
+	if g.undefinedPolicy != PlaceholderForUndefined {
+		return nil
+	}
+
+	set := map[Key]bool{}
+	for i := range g.keys {
+		if g.isUndefined(i) {
+			set[g.keys[i]] = true
+		}
+	}
+
+	return sortedKeys(set)
+}
+
+// hasUndefinedNodes returns true when any edge refers to a node that is never added
+func (g *DAG) hasUndefinedNodes() bool {
+	for i := range g.keys {
+		if g.isUndefined(i) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,220 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DuplicateEdgeError is reported by Validate for an edge that is added more than once
+type DuplicateEdgeError struct {
+	Edge Edge
+}
+
+func (e *DuplicateEdgeError) Error() string {
+	return fmt.Sprintf("edge %s is added more than once", e.Edge)
+}
+
+// IsolatedNodeError is reported by Validate for a node that neither depends on nor is depended by any node
+type IsolatedNodeError struct {
+	Node Key
+}
+
+func (e *IsolatedNodeError) Error() string {
+	return fmt.Sprintf("node %q is isolated: it neither depends on nor is depended by any node", e.Node)
+}
+
+// Validate returns every problem found in the graph, rather than only the first one as Sort does.
+//
+// Problems are reported in the following order, each kind ordered by Key.Less:
+// *Error for a cycle in each strongly connected set of nodes, *SelfLoopError for each node that depends on itself,
+// *UndefinedDependencyError and *UndefinedDependentError for each undefined node referred to by edges, *DuplicateEdgeError for each edge added more than once,
+// and *IsolatedNodeError for each node that has no edges.
+//
+// Undefined dependencies are reported regardless of the UndefinedDependencies option.
+// It returns nil when the graph has no problems.
+func (g *DAG) Validate() []error {
+	g.rlock()
+	defer g.runlock()
+
+	var errs []error
+
+	for _, scc := range g.stronglyConnected() {
+		if len(scc) > 1 {
+			errs = append(errs, &Error{Cycle: &Cycle{Path: g.cycleWithin(scc)}})
+		}
+	}
+
+	selfLoops := map[Key]bool{}
+	for from, tos := range g.outputs {
+		if tos[from] {
+			selfLoops[from] = true
+		}
+	}
+
+	for _, k := range sortedKeys(selfLoops) {
+		errs = append(errs, &SelfLoopError{Node: k})
+	}
+
+	var undefined []int
+	for i := range g.keys {
+		if g.isUndefined(i) {
+			undefined = append(undefined, i)
+		}
+	}
+	g.sortIds(undefined)
+
+	for _, i := range undefined {
+		errs = append(errs, g.undefinedErrors(i)...)
+	}
+
+	var duplicates []Edge
+	for e := range g.duplicates {
+		duplicates = append(duplicates, e)
+	}
+	sortEdges(duplicates)
+
+	for _, e := range duplicates {
+		errs = append(errs, &DuplicateEdgeError{Edge: e})
+	}
+
+	for _, n := range g.sortedNodes() {
+		if i := g.ids[n]; len(g.children[i]) == 0 && g.numInputs[i] == 0 {
+			errs = append(errs, &IsolatedNodeError{Node: n})
+		}
+	}
+
+	return errs
+}
+
+// sortIds orders the ids by Key.Less of their keys
+func (g *DAG) sortIds(ids []int) {
+	sort.Slice(ids, func(i, j int) bool {
+		return g.keys[ids[i]].Less(g.keys[ids[j]])
+	})
+}
+
+// stronglyConnected returns the strongly connected components of the graph, including undefined nodes,
+// each ordered by Key.Less and ordered by their least keys.
+//
+// See https://en.wikipedia.org/wiki/Tarjan%27s_strongly_connected_components_algorithm
+func (g *DAG) stronglyConnected() [][]int {
+	n := len(g.keys)
+
+	index := make([]int, n)
+	lowlink := make([]int, n)
+	onStack := make([]bool, n)
+	for i := range index {
+		index[i] = -1
+	}
+
+	var (
+		stack []int
+		sccs  [][]int
+		next  int
+	)
+
+	var visit func(v int)
+	visit = func(v int) {
+		index[v], lowlink[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.children[v] {
+			if index[w] < 0 {
+				visit(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+
+		if lowlink[v] != index[v] {
+			return
+		}
+
+		var scc []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		g.sortIds(scc)
+		sccs = append(sccs, scc)
+	}
+
+	for v := 0; v < n; v++ {
+		if index[v] < 0 {
+			visit(v)
+		}
+	}
+
+	sort.Slice(sccs, func(i, j int) bool {
+		return g.keys[sccs[i][0]].Less(g.keys[sccs[j][0]])
+	})
+
+	return sccs
+}
+
+// cycleWithin returns the shortest cycle through the least node of the strongly connected component,
+// in the same form as the one returned by Sort.
+func (g *DAG) cycleWithin(scc []int) []Key {
+	in := make(map[int]bool, len(scc))
+	for _, i := range scc {
+		in[i] = true
+	}
+
+	start := scc[0]
+
+	// Breadth-first search back to the start, visiting children in the order of Key.Less to make the result stable
+	prev := map[int]int{}
+	queue := []int{start}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		children := append([]int(nil), g.children[cur]...)
+		g.sortIds(children)
+
+		for _, c := range children {
+			if !in[c] {
+				continue
+			}
+
+			if c == start {
+				if cur == start {
+					// Self-loops are reported separately
+					continue
+				}
+
+				var rev []Key
+				for v := cur; v != start; v = prev[v] {
+					rev = append(rev, g.keys[v])
+				}
+
+				cycle := []Key{g.keys[start]}
+				for i := len(rev) - 1; i >= 0; i-- {
+					cycle = append(cycle, rev[i])
+				}
+
+				return append(cycle, g.keys[start])
+			}
+
+			if _, ok := prev[c]; ok {
+				continue
+			}
+
+			prev[c] = cur
+			queue = append(queue, c)
+		}
+	}
+
+	panic(fmt.Errorf("invalid state: no cycle found within %v", g.keysOf(scc)))
+}
@@ -2,9 +2,17 @@ package strdag
 
 import (
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/variantdev/dag/pkg/dag"
 )
 
 func TestDAG_GraphAPI(t *testing.T) {
@@ -371,6 +379,119 @@ func TestDAG_GraphAPICycle(t *testing.T) {
 	}
 }
 
+func TestDAG_Errors(t *testing.T) {
+	g := New(Nodes([]string{"a", "b", "c", "web"}))
+	g.AddEdge("b", "a")
+	g.AddEdge("a", "c")
+	g.AddEdge("c", "b")
+
+	_, err := g.Sort()
+
+	var ce *CycleError
+	if !errors.As(err, &ce) {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	if expected := []string{"a", "c", "b", "a"}; !reflect.DeepEqual(ce.Cycle.Path, expected) {
+		t.Errorf("unexpected result: expected=%v, got=%v", expected, ce.Cycle.Path)
+	}
+
+	var de *dag.Error
+	if !errors.As(err, &de) || !errors.Is(err, ErrCycle) || errors.Is(err, ErrUndefined) {
+		t.Errorf("expected the cycle error to wrap *dag.Error and match ErrCycle only")
+	}
+
+	g = New(Nodes([]string{"web"}))
+	g.AddDependencies("web", []string{"ng"})
+
+	_, err = g.Sort()
+
+	var ude *UndefinedDependencyError
+	if !errors.As(err, &ude) || !errors.Is(err, ErrUndefined) {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	if ude.UndefinedNode != "ng" || !reflect.DeepEqual(ude.Dependents, []string{"web"}) {
+		t.Errorf("unexpected result: %+v", ude)
+	}
+
+	g = New(Nodes([]string{"api"}))
+	g.AddDependencies("web", []string{"api"})
+
+	_, err = g.Sort()
+
+	var udde *UndefinedDependentError
+	if !errors.As(err, &udde) || !errors.Is(err, ErrUndefined) {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	if udde.UndefinedNode != "web" || !reflect.DeepEqual(udde.Dependencies, []string{"api"}) {
+		t.Errorf("unexpected result: %+v", udde)
+	}
+
+	g = New(Nodes([]string{"a"}))
+	g.AddEdge("a", "a")
+
+	_, err = g.Sort()
+
+	var sle *SelfLoopError
+	if !errors.As(err, &sle) || !errors.Is(err, ErrCycle) || sle.Node != "a" {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Nodes([]string{"web", "api"}))
+	g.AddDependencies("web", []string{"api"})
+
+	_, err = g.Sort(Only("web"))
+
+	var uhe *UnhandledDependencyError
+	if !errors.As(err, &uhe) || !errors.Is(err, ErrUnhandled) || uhe.UnhandledDependencies[0].Id != "api" {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Strict(), Nodes([]string{"web"}))
+
+	err = g.AddEdgeE("api", "web")
+
+	var une *UndefinedNodeError
+	if !errors.As(err, &une) || !errors.Is(err, ErrUndefined) {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	if une.Node != "api" || une.Edge != (Edge{From: "api", To: "web"}) {
+		t.Errorf("unexpected result: %+v", une)
+	}
+
+	g1 := New(Nodes([]string{"web"}))
+	g2 := New(Nodes([]string{"web"}))
+
+	_, _, err = MergeWithOptions([]*DAG{g1, g2}, FailOnDuplicateNode())
+
+	var mce *MergeConflictError
+	if !errors.As(err, &mce) || mce.Node != "web" || mce.Sources != [2]int{0, 1} {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	g = New(Nodes([]string{"web", "api", "lonely"}))
+	g.AddEdge("api", "web")
+	g.AddEdge("api", "web")
+
+	errs := g.Validate()
+	if len(errs) != 2 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	var dee *DuplicateEdgeError
+	if !errors.As(errs[0], &dee) || dee.Edge != (Edge{From: "api", To: "web"}) {
+		t.Errorf("unexpected error: %v(%T)", errs[0], errs[0])
+	}
+
+	var ine *IsolatedNodeError
+	if !errors.As(errs[1], &ine) || ine.Node != "lonely" {
+		t.Errorf("unexpected error: %v(%T)", errs[1], errs[1])
+	}
+}
+
 func TestDAG_UndefinedDependency_MaybeTypo(t *testing.T) {
 	g2 := New()
 	g2.Add(
@@ -394,3 +515,808 @@ func TestDAG_UndefinedDependency_MaybeTypo(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 }
+
+func TestDAG_UndefinedDependency_Placeholder(t *testing.T) {
+	g := New(UndefinedDependencies(PlaceholderForUndefined))
+	g.Add("web", Dependencies([]string{"ok", "ng"}))
+	g.Add("ok")
+
+	res, err := g.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "ng, ok -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	var placeholders []string
+	for _, n := range res[0] {
+		if n.Placeholder {
+			placeholders = append(placeholders, n.Id)
+		}
+	}
+
+	if expected := []string{"ng"}; !reflect.DeepEqual(placeholders, expected) {
+		t.Errorf("unexpected placeholders: expected=%v, got=%v", expected, placeholders)
+	}
+}
+
+func TestDAG_Orderings(t *testing.T) {
+	g := New(Nodes([]string{"web", "api", "db"}))
+	g.AddDependencies("web", []string{"api"})
+
+	orders, err := g.Orderings(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"api", "db", "web"},
+		{"api", "web", "db"},
+		{"db", "api", "web"},
+	}
+
+	if !reflect.DeepEqual(expected, orders) {
+		t.Errorf("unexpected result: expected=%v, got=%v", expected, orders)
+	}
+
+	count, err := g.CountOrderings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count.Int64() != 3 {
+		t.Errorf("unexpected count: expected=3, got=%v", count)
+	}
+
+	order, err := g.RandomOrder(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(order) != 3 {
+		t.Errorf("unexpected ordering: %v", order)
+	}
+}
+
+func TestDAG_RedundantEdges(t *testing.T) {
+	g := New(Nodes([]string{"web", "api", "net"}))
+	g.AddDependencies("web", []string{"api", "net"})
+	g.AddDependencies("api", []string{"net"})
+
+	edges, err := g.RedundantEdges()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(edges) != 1 {
+		t.Fatalf("unexpected number of redundant edges: %v", edges)
+	}
+
+	if expected, actual := "net -> web is implied by net -> api -> web", edges[0].String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	r, err := g.TransitiveReduction()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	edges, err = r.RedundantEdges()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(edges) != 0 {
+		t.Errorf("unexpected redundant edges after reduction: %v", edges)
+	}
+}
+
+func TestDAG_Subgraph(t *testing.T) {
+	g := New()
+	g.Add("release/web", Dependencies([]string{"release/api", "release/net"}), Labels([]string{"tier:web"}))
+	g.Add("release/api", Dependencies([]string{"release/db", "release/net"}), Labels([]string{"tier:api"}))
+	g.Add("release/db", Dependencies([]string{"release/net"}), Labels([]string{"tier:db"}))
+	g.Add("release/net")
+
+	s := g.Subgraph("release/web", "release/api", "release/unknown")
+
+	w := &bytes.Buffer{}
+	if err := s.WriteDotTo(w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `digraph DAG {
+rankdir="LR"
+"release/api" [shape=record, label="{release/api|{tier:api}}"]
+"release/web" [shape=record, label="{release/web|{tier:web}}"]
+"release/api" -> "release/web"
+}
+`
+	if actual := w.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	i := g.Induced(func(id string) bool {
+		return id != "release/api"
+	})
+
+	res, err := i.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "release/net -> release/db, release/web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestDAG_Merge(t *testing.T) {
+	g1 := New()
+	g1.Add("web", Dependencies([]string{"api"}), Labels([]string{"tier:web"}))
+	g1.Add("api", Dependencies([]string{"net"}))
+
+	g2 := New()
+	g2.Add("api", Dependencies([]string{"db", "net"}), Labels([]string{"tier:api"}))
+	g2.Add("db")
+	g2.Add("net")
+
+	m, report, err := Merge(g1, g2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := m.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "db, net -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	if expected, actual := []int{0, 1}, report.Nodes["api"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected sources of api: expected=%v, got=%v", expected, actual)
+	}
+
+	if expected, actual := []int{0, 1}, report.Edges[Edge{From: "net", To: "api"}]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected sources of net -> api: expected=%v, got=%v", expected, actual)
+	}
+
+	if expected, actual := []int{1}, report.Labels["api"]["tier:api"]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected sources of label tier:api: expected=%v, got=%v", expected, actual)
+	}
+
+	_, _, err = MergeWithOptions([]*DAG{g1, g2}, FailOnLabelConflict())
+	if expected := `node "api" is defined with different labels in graph 0 and 1: [] and [tier:api]`; err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected=%q, got=%v", expected, err)
+	}
+
+	_, _, err = MergeWithOptions([]*DAG{g1, g2}, FailOnDuplicateNode())
+	if expected := `node "api" is defined in both graph 0 and 1`; err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected=%q, got=%v", expected, err)
+	}
+}
+
+func TestDAG_Diff(t *testing.T) {
+	a := New()
+	a.Add("web", Dependencies([]string{"api", "cache"}))
+	a.Add("api", Dependencies([]string{"db"}), Labels([]string{"tier:db"}))
+	a.Add("cache")
+	a.Add("db")
+
+	b := New()
+	b.Add("web", Dependencies([]string{"api", "net"}))
+	b.Add("api", Dependencies([]string{"db"}), Labels([]string{"tier:api"}))
+	b.Add("db")
+	b.Add("net")
+
+	d := Diff(a, b)
+
+	if expected, actual := []string{"net"}, d.AddedNodes; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected added nodes: expected=%v, got=%v", expected, actual)
+	}
+
+	if expected, actual := []Edge{{From: "cache", To: "web"}}, d.RemovedEdges; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected removed edges: expected=%v, got=%v", expected, actual)
+	}
+
+	expectedText := `+ node net
+- node cache
++ edge net -> web
+- edge cache -> web
+~ labels api: +tier:api -tier:db
+`
+	if actual := d.String(); actual != expectedText {
+		t.Errorf("unexpected result: expected=%q, got=%q", expectedText, actual)
+	}
+
+	w := &bytes.Buffer{}
+	if err := d.WriteDotTo(w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedDot := `digraph DAG {
+rankdir="LR"
+"api" [shape=record, label="{api|{tier:api}}", color="orange"]
+"cache" [shape=record, label="{cache}", color="red", style="dashed"]
+"db" [shape=record, label="{db}"]
+"net" [shape=record, label="{net}", color="green"]
+"web" [shape=record, label="{web}"]
+"api" -> "web"
+"cache" -> "web" [color="red", style="dashed"]
+"db" -> "api"
+"net" -> "web" [color="green"]
+}
+`
+	if actual := w.String(); actual != expectedDot {
+		t.Errorf("unexpected result: expected=%q, got=%q", expectedDot, actual)
+	}
+
+	if !Diff(b, b).Empty() {
+		t.Errorf("expected no difference between the same graphs")
+	}
+}
+
+func TestDAG_Clone(t *testing.T) {
+	g := New()
+	g.Add("web", Dependencies([]string{"api", "net"}), Labels([]string{"tier:web"}))
+	g.Add("api", Dependencies([]string{"net"}))
+	g.Add("net")
+
+	c := g.Clone()
+	c.RemoveEdge("api", "web")
+	c.Add("web", Labels([]string{"changed"}))
+	c.Add("db")
+
+	res, err := g.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "net -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result of the original: expected=%q, got=%q", expected, actual)
+	}
+
+	res, err = c.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected, actual := "db, net -> api, web", res.String(); actual != expected {
+		t.Errorf("unexpected result of the clone: expected=%q, got=%q", expected, actual)
+	}
+
+	expected := []LabelChange{{Node: "web", Added: []string{"changed"}}}
+	if actual := Diff(g, c).ChangedLabels; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected label changes: expected=%v, got=%v", expected, actual)
+	}
+}
+
+func TestDAG_JSON(t *testing.T) {
+	g := New()
+	g.Add("web", Dependencies([]string{"api", "net"}), Labels([]string{"tier:web"}))
+	g.Add("api", Dependencies([]string{"net"}))
+	g.Add("net")
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"version":1,"nodes":[{"id":"web","labels":["tier:web"]},{"id":"api"},{"id":"net"}],` +
+		`"edges":[{"from":"api","to":"web"},{"from":"net","to":"api"},{"from":"net","to":"web"}]}`
+	if actual := string(b); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	var c DAG
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d := Diff(g, &c); !d.Empty() {
+		t.Errorf("unexpected difference after round-trip:\n%s", d)
+	}
+
+	err = json.Unmarshal([]byte(`{"version":2,"nodes":[],"edges":[]}`), &c)
+	if expected := "unsupported schema version 2: expected 1"; err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected=%q, got=%v", expected, err)
+	}
+}
+
+func TestReadYAML(t *testing.T) {
+	doc := `nodes:
+- name: web
+  dependsOn: [api, net]
+  labels: [tier:web]
+- name: api
+  dependsOn:
+  - net
+  - db
+- name: net
+`
+
+	g, err := ReadYAML(strings.NewReader(doc), "releases.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = g.Plan()
+
+	var ude *UndefinedDependencyError
+	if !errors.As(err, &ude) {
+		t.Fatalf("unexpected error: %v(%T)", err, err)
+	}
+
+	if expected, actual := `releases.yaml:8:5: undefined node "db" is depended by node(s): api`, err.Error(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	g.Add("db", Dependencies([]string{"web"}))
+
+	_, err = g.Plan()
+	if expected, actual := `releases.yaml:3:15: cycle detected: api -> web -> db -> api`, fmt.Sprint(err); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	_, err = ReadYAML(strings.NewReader("nodes:\n- name: a\n- name: a\n"), "releases.yaml")
+	if expected, actual := `releases.yaml:3:9: node "a" is already defined at releases.yaml:2:9`, fmt.Sprint(err); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	// Strict graphs accept dependencies on nodes listed later, and reject undefined ones at their positions
+	g, err = ReadYAML(strings.NewReader("nodes:\n- name: web\n  dependsOn: [api]\n- name: api\n"), "releases.yaml", Strict())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := g.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	_, err = ReadYAML(strings.NewReader("nodes:\n- name: web\n  dependsOn: [api]\n"), "releases.yaml", Strict())
+	if expected, actual := `releases.yaml:3:15: cannot add edge api -> web: undefined node "api"`, fmt.Sprint(err); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	_, err = ReadYAML(strings.NewReader("nodes:\n- name: a\n  needs: [b]\n"), "")
+	if err == nil || !strings.HasPrefix(err.Error(), "<input>: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReadDot(t *testing.T) {
+	g := New()
+	g.Add("release/web", Dependencies([]string{"release/api", "release/net"}), Labels([]string{"a", "b"}))
+	g.Add("release/api", Dependencies([]string{"release/net"}), Labels([]string{"tier:api"}))
+	g.Add("release/net")
+
+	var buf bytes.Buffer
+	if err := g.WriteDotTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c, err := ReadDot(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d := Diff(g, c); !d.Empty() {
+		t.Errorf("unexpected difference after round-trip:\n%s", d)
+	}
+
+	// Characters that are special in DOT strings and record labels survive a round-trip
+	for _, id := range []string{`a\`, `a\\`, `"quoted"`, `say \"hi\"`, `x|y`, `{braces}`, `<port>`, ` sp `} {
+		g := New()
+		g.Add(id, Dependencies([]string{id + ` dep\`}), Labels([]string{id, `\` + id}))
+		g.Add(id + ` dep\`)
+
+		var buf bytes.Buffer
+		if err := g.WriteDotTo(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		c, err := ReadDot(&buf)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", id, err)
+		}
+
+		if d := Diff(g, c); !d.Empty() {
+			t.Errorf("unexpected difference after round-trip of %q:\n%s", id, d)
+		}
+	}
+
+	hand := `strict digraph deps {
+  // Hand-drawn graphs may use chains, subgraphs and unquoted IDs
+  rankdir=LR; node [shape=box]
+  net -> api -> web [color=red]
+  subgraph cluster_data {
+    label = "data"
+    db; cache /* not depended yet */
+  }
+  db -> api
+  # Record labels other than the ones written by WriteDotTo are ignored
+  web [label="Web"]
+  "db" [shape=record, label="{db|{tier:db|backup\|daily}}"]
+}
+`
+
+	c, err = ReadDot(strings.NewReader(hand))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := c.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "cache, db, net -> api -> web", res.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	var labels bytes.Buffer
+	if err := c.WriteDotTo(&labels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := `"db" [shape=record, label="{db|{backup\|daily|tier:db}}"]`; !strings.Contains(labels.String(), expected) {
+		t.Errorf("expected %q in the output:\n%s", expected, labels.String())
+	}
+
+	for _, tc := range []struct {
+		src      string
+		expected string
+	}{
+		{src: "graph { a -- b }", expected: "line 1: undirected graphs are not supported"},
+		{src: "digraph {\n a:p -> b\n}", expected: "line 2: ports are not supported"},
+		{src: "digraph {\n a -> \n}", expected: `line 3: expected a node after "->", got "}"`},
+		{src: "digraph {\n a [label=<b>]\n}", expected: "line 2: HTML strings are not supported"},
+		{src: "digraph { a", expected: `line 1: expected "}", got end of input`},
+	} {
+		_, err := ReadDot(strings.NewReader(tc.src))
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("unexpected error for %q: expected=%q, got=%v", tc.src, tc.expected, err)
+		}
+	}
+}
+
+func TestDAG_WriteMermaidTo(t *testing.T) {
+	g := New()
+	g.Add("release/web", Dependencies([]string{"release/api", "release/net"}), Labels([]string{"a", `"b"`}))
+	g.Add("release/api", Dependencies([]string{"release/net"}), Labels([]string{"tier:api"}))
+	g.Add("release/net")
+
+	var buf bytes.Buffer
+	if err := g.WriteMermaidTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `flowchart LR
+  n0["release/api<br/>tier:api"]
+  n1["release/net"]
+  n2["release/web<br/>#quot;b#quot;, a"]
+  n0 --> n2
+  n1 --> n0
+  n1 --> n2
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	buf.Reset()
+	if err := g.WriteMermaidTo(&buf, GroupByLevel()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected = `flowchart LR
+  subgraph level0["Level 0"]
+    n1["release/net"]
+  end
+  subgraph level1["Level 1"]
+    n0["release/api<br/>tier:api"]
+  end
+  subgraph level2["Level 2"]
+    n2["release/web<br/>#quot;b#quot;, a"]
+  end
+  n0 --> n2
+  n1 --> n0
+  n1 --> n2
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	g.AddEdge("release/web", "release/net")
+
+	err := g.WriteMermaidTo(&buf, GroupByLevel())
+	if !errors.Is(err, ErrCycle) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var ce *CycleError
+	if !errors.As(err, &ce) {
+		t.Errorf("unexpected error: %v(%T)", err, err)
+	}
+}
+
+func TestDAG_WriteDot(t *testing.T) {
+	g := New()
+	g.Add("web", Dependencies([]string{"api"}), Labels([]string{"tier:front"}))
+	g.Add("api", Dependencies([]string{"db"}), Labels([]string{"tier:back"}))
+	g.Add("db", Labels([]string{"tier:back", "critical"}))
+	g.Add("net")
+
+	var buf bytes.Buffer
+	err := g.WriteDot(&buf,
+		RankDir("TB"),
+		NodeShape("box"),
+		LabelStyle("critical", `style="filled"`, `fillcolor="pink"`),
+		ClusterByLabelPrefix("tier:"),
+		Highlight("api", "db"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `digraph DAG {
+rankdir="TB"
+subgraph "cluster_back" {
+label="back"
+"api" [shape=box, label="api\ntier:back", color="red", penwidth=2]
+"db" [shape=box, label="db\ncritical\ntier:back", style="filled", fillcolor="pink", color="red", penwidth=2]
+}
+subgraph "cluster_front" {
+label="front"
+"web" [shape=box, label="web\ntier:front"]
+}
+"net" [shape=box, label="net"]
+"api" -> "web"
+"db" -> "api" [color="red", penwidth=2]
+}
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	// Keys and labels having special characters in record labels survive a round-trip
+	g = New()
+	g.Add(`a|b{c}<d>\e"f`, Labels([]string{`x|y`, `{z}`}))
+
+	buf.Reset()
+	if err := g.WriteDotTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := `"a|b{c}<d>\e\"f" [shape=record, label="{a\|b\{c\}\<d\>\\e\"f|{x\|y|\{z\}}}"]`; !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+	}
+
+	c, err := ReadDot(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d := Diff(g, c); !d.Empty() {
+		t.Errorf("unexpected difference after round-trip:\n%s", d)
+	}
+}
+
+func TestTopology_WriteDotTo(t *testing.T) {
+	g := New(Nodes([]string{"web", "api", "db", "cache", "mesh", "net"}))
+	g.AddDependencies("web", []string{"api", "cache", "net"})
+	g.AddDependencies("api", []string{"db", "cache", "net"})
+	g.AddDependencies("db", []string{"net"})
+	g.AddDependencies("mesh", []string{"net"})
+
+	res, err := g.Plan(Only("api", "web"), WithoutDependencies())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := res.WriteDotTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `digraph DAG {
+rankdir="LR"
+"api" [shape=record, label="{api}"]
+{rank=same; "api"}
+"web" [shape=record, label="{web}"]
+{rank=same; "web"}
+"api" -> "web"
+}
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	res, err = g.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	if err := res.WriteDotTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "\n{rank=same; \"cache\"; \"net\"}\n"; !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+	}
+
+	if expected := "\n{rank=same; \"db\"; \"mesh\"}\n"; !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+	}
+}
+
+func TestTopology_WriteTreeTo(t *testing.T) {
+	g := New(Nodes([]string{"web", "api", "db", "cache", "mesh", "net"}))
+	g.AddDependencies("web", []string{"api", "cache", "net"})
+	g.AddDependencies("api", []string{"db", "cache", "net"})
+	g.AddDependencies("db", []string{"net"})
+	g.AddDependencies("mesh", []string{"net"})
+
+	var buf bytes.Buffer
+	if err := g.WriteTextTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `cache
+├── api
+│   └── web
+└── web
+net
+├── api (*)
+├── db
+│   └── api (*)
+├── mesh
+└── web
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	res, err := g.Plan(Only("api", "web"), WithoutDependencies())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf.Reset()
+	if err := res.WriteTreeTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected, actual := "api\n└── web\n", buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestTopology_JSONAndParse(t *testing.T) {
+	g := New(Nodes([]string{"web", "api, v2", "db->replica", `net\1`}))
+	g.AddDependencies("web", []string{"api, v2"})
+	g.AddDependencies("api, v2", []string{"db->replica", `net\1`})
+
+	res, err := g.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := res.String()
+	if expected := `db-\>replica, net\\1 -> api\, v2 -> web`; s != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, s)
+	}
+
+	groups, err := ParseTopology(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := [][]string{{"db->replica", `net\1`}, {"api, v2"}, {"web"}}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, groups)
+	}
+
+	for _, invalid := range []string{"a, b -> ", "a,b", "a->b", `a\`} {
+		if _, err := ParseTopology(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// json.Marshal escapes ">" for safe embedding in HTML
+	expected := `[[{"id":"db-\u003ereplica","parents":[],"children":["api, v2"]},{"id":"net\\1","parents":[],"children":["api, v2"]}],` +
+		`[{"id":"api, v2","parents":["db-\u003ereplica","net\\1"],"children":["web"]}],` +
+		`[{"id":"web","parents":["api, v2"],"children":[]}]]`
+	if actual := string(b); actual != expected {
+		t.Errorf("unexpected result: expected=%s, got=%s", expected, actual)
+	}
+
+	var decoded Topology
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if decoded.String() != s || !reflect.DeepEqual(decoded[1][0].ParentIds, []string{"db->replica", `net\1`}) {
+		t.Errorf("unexpected result of decoding: %s", decoded)
+	}
+}
+
+func TestDAG_WriteGraphMLTo(t *testing.T) {
+	g := New()
+	g.Add("web", Dependencies([]string{"api"}), Labels([]string{"tier:web", "a&b"}))
+	g.Add("api")
+
+	var buf bytes.Buffer
+	if err := g.WriteGraphMLTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="labels" for="node" attr.name="labels" attr.type="string"/>
+  <key id="level" for="node" attr.name="level" attr.type="int"/>
+  <graph id="DAG" edgedefault="directed">
+    <node id="api">
+      <data key="labels"></data>
+      <data key="level">0</data>
+    </node>
+    <node id="web">
+      <data key="labels">a&amp;b|tier:web</data>
+      <data key="level">1</data>
+    </node>
+    <edge source="api" target="web"/>
+  </graph>
+</graphml>
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf("unexpected result: expected=%q, got=%q", expected, actual)
+	}
+
+	buf.Reset()
+	if err := g.WriteGEXFTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		`<node id="web" label="web">`,
+		`<attvalue for="labels" value="a&amp;b|tier:web"/>`,
+		`<attvalue for="level" value="1"/>`,
+		`<edge id="0" source="api" target="web"/>`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, buf.String())
+		}
+	}
+
+	// Both documents are well-formed
+	for _, write := range []func(io.Writer) error{g.WriteGraphMLTo, g.WriteGEXFTo} {
+		buf.Reset()
+		if err := write(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dec := xml.NewDecoder(&buf)
+		for {
+			_, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	g.AddEdge("web", "api")
+
+	if err := g.WriteGraphMLTo(&buf); !errors.Is(err, ErrCycle) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package strdag
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// ReadDot returns a new graph created with the options from a Graphviz digraph, e.g. the one written by WriteDotTo.
+//
+// A reasonable subset of the DOT language is supported: node and edge statements including edge chains like
+// "a -> b -> c", attribute lists, graph attributes, and subgraphs whose statements are read as if they were
+// written at the top level. Every node mentioned in the graph is added, including the ones only used in edges.
+//
+// Labels are read from record labels in the form written by WriteDotTo, i.e. "{name|{label1|label2}}".
+// Other attributes are ignored, while undirected graphs, ports and HTML strings are rejected.
+// Backslashes doubled by WriteDotTo right before double quotes are read back as they were.
+func ReadDot(r io.Reader, opts ...Option) (*DAG, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := lexDot(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &dotParser{tokens: tokens, d: New(opts...)}
+
+	if err := p.parseGraph(); err != nil {
+		return nil, err
+	}
+
+	return p.d, nil
+}
+
+type dotTokenKind int
+
+const (
+	dotID dotTokenKind = iota
+	dotPunct
+	dotEOF
+)
+
+type dotToken struct {
+	kind dotTokenKind
+	// text is the identifier with quotes and escapes removed, or the punctuation like "{" and "->"
+	text   string
+	quoted bool
+	line   int
+}
+
+func (t dotToken) is(punct string) bool {
+	return t.kind == dotPunct && t.text == punct
+}
+
+// isKeyword returns true when the token is the unquoted keyword, which is case-insensitive in DOT
+func (t dotToken) isKeyword(kw string) bool {
+	return t.kind == dotID && !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+func (t dotToken) String() string {
+	switch t.kind {
+	case dotEOF:
+		return "end of input"
+	case dotPunct:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Sprintf("identifier %q", t.text)
+}
+
+func lexDot(src string) ([]dotToken, error) {
+	var tokens []dotToken
+
+	line := 1
+	rs := []rune(src)
+
+	isIDRune := func(r rune) bool {
+		return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	for i := 0; i < len(rs); {
+		c := rs[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || c == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == '/') {
+				if rs[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i+1 >= len(rs) {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			i += 2
+		case c == '-' && i+1 < len(rs) && (rs[i+1] == '>' || rs[i+1] == '-'):
+			tokens = append(tokens, dotToken{kind: dotPunct, text: string(rs[i : i+2]), line: line})
+			i += 2
+		case strings.ContainsRune("{}[]=;,:", c):
+			tokens = append(tokens, dotToken{kind: dotPunct, text: string(c), line: line})
+			i++
+		case c == '<':
+			return nil, fmt.Errorf("line %d: HTML strings are not supported", line)
+		case c == '"':
+			start := line
+			var b strings.Builder
+			i++
+			for ; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' {
+					n := 1
+					for i+n < len(rs) && rs[i+n] == '\\' {
+						n++
+					}
+
+					switch {
+					case i+n < len(rs) && rs[i+n] == '"':
+						// Backslashes right before a double quote are doubled by WriteDotTo,
+						// with an odd one left escaping the quote
+						b.WriteString(strings.Repeat(`\`, n/2))
+						i += n - 1
+						if n%2 == 1 {
+							b.WriteRune('"')
+							i++
+						}
+					case i+n < len(rs) && rs[i+n] == '\n':
+						// A backslash at the end of a line continues the string
+						b.WriteString(strings.Repeat(`\`, n-1))
+						i += n
+						line++
+					default:
+						// Keep other escapes as they are like Graphviz does, as they are meaningful in labels
+						b.WriteString(strings.Repeat(`\`, n))
+						i += n - 1
+					}
+					continue
+				}
+				if rs[i] == '\n' {
+					line++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("line %d: unterminated string", start)
+			}
+			i++
+			tokens = append(tokens, dotToken{kind: dotID, text: b.String(), quoted: true, line: start})
+		case isIDRune(c) || c == '-':
+			start := i
+			i++
+			for i < len(rs) && isIDRune(rs[i]) {
+				i++
+			}
+			tokens = append(tokens, dotToken{kind: dotID, text: string(rs[start:i]), line: line})
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+		}
+	}
+
+	return append(tokens, dotToken{kind: dotEOF, line: line}), nil
+}
+
+type dotParser struct {
+	tokens []dotToken
+	pos    int
+
+	d *DAG
+}
+
+func (p *dotParser) peek() dotToken {
+	return p.tokens[p.pos]
+}
+
+func (p *dotParser) next() dotToken {
+	t := p.tokens[p.pos]
+	if t.kind != dotEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *dotParser) expect(punct string) error {
+	if t := p.next(); !t.is(punct) {
+		return fmt.Errorf("line %d: expected %q, got %s", t.line, punct, t)
+	}
+	return nil
+}
+
+func (p *dotParser) parseGraph() error {
+	if p.peek().isKeyword("strict") {
+		p.next()
+	}
+
+	t := p.next()
+	if t.isKeyword("graph") {
+		return fmt.Errorf("line %d: undirected graphs are not supported", t.line)
+	}
+	if !t.isKeyword("digraph") {
+		return fmt.Errorf("line %d: expected \"digraph\", got %s", t.line, t)
+	}
+
+	if p.peek().kind == dotID {
+		p.next()
+	}
+
+	if err := p.parseBlock(); err != nil {
+		return err
+	}
+
+	if t := p.next(); t.kind != dotEOF {
+		return fmt.Errorf("line %d: unexpected %s after the graph", t.line, t)
+	}
+
+	return nil
+}
+
+// parseBlock parses statements enclosed in braces
+func (p *dotParser) parseBlock() error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	for {
+		t := p.peek()
+
+		switch {
+		case t.is("}"):
+			p.next()
+			return nil
+		case t.kind == dotEOF:
+			return fmt.Errorf("line %d: expected \"}\", got %s", t.line, t)
+		case t.is(";") || t.is(","):
+			p.next()
+		case t.is("{"):
+			if err := p.parseBlock(); err != nil {
+				return err
+			}
+		case t.isKeyword("subgraph"):
+			p.next()
+			if p.peek().kind == dotID {
+				p.next()
+			}
+			if err := p.parseBlock(); err != nil {
+				return err
+			}
+		case t.isKeyword("graph") || t.isKeyword("node") || t.isKeyword("edge"):
+			// Default attributes don't affect nodes, edges and labels
+			p.next()
+			if _, err := p.parseAttrs(); err != nil {
+				return err
+			}
+		case t.kind == dotID:
+			if err := p.parseStatement(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line %d: unexpected %s", t.line, t)
+		}
+	}
+}
+
+// parseStatement parses a graph attribute, a node statement or an edge statement
+func (p *dotParser) parseStatement() error {
+	first := p.next()
+
+	if p.peek().is("=") {
+		p.next()
+		if t := p.next(); t.kind != dotID {
+			return fmt.Errorf("line %d: expected a value of %q, got %s", t.line, first.text, t)
+		}
+		return nil
+	}
+
+	ids := []string{first.text}
+
+	for {
+		t := p.peek()
+
+		if t.is("--") {
+			return fmt.Errorf("line %d: undirected edges are not supported", t.line)
+		}
+		if t.is(":") {
+			return fmt.Errorf("line %d: ports are not supported", t.line)
+		}
+		if !t.is("->") {
+			break
+		}
+		p.next()
+
+		to := p.next()
+		if to.kind != dotID {
+			return fmt.Errorf("line %d: expected a node after \"->\", got %s", to.line, to)
+		}
+		ids = append(ids, to.text)
+	}
+
+	attrs, err := p.parseAttrs()
+	if err != nil {
+		return err
+	}
+
+	// Adding a node twice is a no-op, which makes nodes first mentioned in edges added in the order of appearance
+	p.d.AddNodes(ids...)
+
+	if len(ids) == 1 {
+		if labels, ok := parseRecordLabels(ids[0], attrs["label"]); ok {
+			p.d.d.AddLabel(StringKey(ids[0]), labels...)
+		}
+		return nil
+	}
+
+	for i := 0; i+1 < len(ids); i++ {
+		p.d.AddEdge(ids[i], ids[i+1])
+	}
+
+	return nil
+}
+
+// parseAttrs parses zero or more attribute lists like `[shape=record, label="{a}"]`
+func (p *dotParser) parseAttrs() (map[string]string, error) {
+	attrs := map[string]string{}
+
+	for p.peek().is("[") {
+		p.next()
+
+		for !p.peek().is("]") {
+			if t := p.peek(); t.is(",") || t.is(";") {
+				p.next()
+				continue
+			}
+
+			name := p.next()
+			if name.kind != dotID {
+				return nil, fmt.Errorf("line %d: expected an attribute name, got %s", name.line, name)
+			}
+
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+
+			value := p.next()
+			if value.kind != dotID {
+				return nil, fmt.Errorf("line %d: expected a value of %q, got %s", value.line, name.text, value)
+			}
+
+			attrs[name.text] = value.text
+		}
+		p.next()
+	}
+
+	return attrs, nil
+}
+
+// parseRecordLabels returns the labels in the record label of the node written by WriteDotTo,
+// which is either "{name}" or "{name|{label1|label2}}".
+func parseRecordLabels(id, label string) ([]string, bool) {
+	if !strings.HasPrefix(label, "{") || !strings.HasSuffix(label, "}") {
+		return nil, false
+	}
+
+	fields := splitRecord(label[1 : len(label)-1])
+	if len(fields) == 0 || unescapeRecord(fields[0]) != id {
+		return nil, false
+	}
+
+	if len(fields) == 1 {
+		return nil, true
+	}
+
+	inner := fields[1]
+	if len(fields) != 2 || !strings.HasPrefix(inner, "{") || !strings.HasSuffix(inner, "}") {
+		return nil, false
+	}
+
+	var labels []string
+	for _, f := range splitRecord(inner[1 : len(inner)-1]) {
+		labels = append(labels, unescapeRecord(f))
+	}
+
+	return labels, true
+}
+
+// splitRecord splits the record fields by "|" outside of braces, keeping escaped characters as they are
+func splitRecord(s string) []string {
+	var (
+		fields []string
+		depth  int
+		start  int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '|':
+			if depth == 0 {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(fields, s[start:])
+}
+
+func unescapeRecord(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -1,8 +1,11 @@
 package strdag
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math/big"
+	"strings"
 
 	"github.com/variantdev/dag/pkg/dag"
 )
@@ -30,10 +33,23 @@ func stringsToKeys(ss []string) []dag.Key {
 
 type DAG struct {
 	d *dag.DAG
+
+	// refs is the position of each dependency in the source document, set only when the graph is loaded by ReadYAML
+	refs map[Edge]Position
 }
 
 type Option = dag.Option
 type SortOption = dag.SortOption
+type MergeOption = dag.MergeOption
+type MermaidOption = dag.MermaidOption
+type DotOption = dag.DotOption
+type UndefinedDependencyPolicy = dag.UndefinedDependencyPolicy
+
+const (
+	FailOnUndefined         = dag.FailOnUndefined
+	PlaceholderForUndefined = dag.PlaceholderForUndefined
+	DropUndefined           = dag.DropUndefined
+)
 
 type UnhandledDependencyError struct {
 	*dag.UnhandledDependencyError
@@ -50,9 +66,290 @@ func (e *UnhandledDependencyError) Error() string {
 	return e.UnhandledDependencyError.Error()
 }
 
+func (e *UnhandledDependencyError) Unwrap() error {
+	return e.UnhandledDependencyError
+}
+
+// Position is a location in a source document
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// prefixPosition prefixes the message with the first position, which is where users would fix the error
+func prefixPosition(positions []Position, msg string) string {
+	if len(positions) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", positions[0], msg)
+}
+
+type Cycle struct {
+	Path []string
+}
+
+func (c *Cycle) String() string {
+	return strings.Join(c.Path, " -> ")
+}
+
+// CycleError is the counterpart of *dag.Error.
+// Unlike the other errors, it can't embed the original error as the embedded field would be named Error.
+type CycleError struct {
+	Cycle *Cycle
+
+	// Positions are where the dependencies forming the cycle are defined, known only for graphs loaded by ReadYAML
+	Positions []Position
+
+	err *dag.Error
+}
+
+func (e *CycleError) Error() string {
+	return prefixPosition(e.Positions, e.err.Error())
+}
+
+func (e *CycleError) Unwrap() error {
+	return e.err
+}
+
+type SelfLoopError struct {
+	*dag.SelfLoopError
+
+	Node string
+
+	// Positions are where the node is defined to depend on itself, known only for graphs loaded by ReadYAML
+	Positions []Position
+}
+
+func (e *SelfLoopError) Error() string {
+	return prefixPosition(e.Positions, e.SelfLoopError.Error())
+}
+
+func (e *SelfLoopError) Unwrap() error {
+	return e.SelfLoopError
+}
+
+type UndefinedDependencyError struct {
+	*dag.UndefinedDependencyError
+
+	UndefinedNode string
+	Dependents    []string
+
+	// Positions are where the dependents refer to the undefined node, known only for graphs loaded by ReadYAML
+	Positions []Position
+}
+
+func (e *UndefinedDependencyError) Error() string {
+	return prefixPosition(e.Positions, e.UndefinedDependencyError.Error())
+}
+
+func (e *UndefinedDependencyError) Unwrap() error {
+	return e.UndefinedDependencyError
+}
+
+type UndefinedDependentError struct {
+	*dag.UndefinedDependentError
+
+	UndefinedNode string
+	Dependencies  []string
+
+	// Positions are where the undefined node refers to its dependencies, known only for graphs loaded by ReadYAML
+	Positions []Position
+}
+
+func (e *UndefinedDependentError) Error() string {
+	return prefixPosition(e.Positions, e.UndefinedDependentError.Error())
+}
+
+func (e *UndefinedDependentError) Unwrap() error {
+	return e.UndefinedDependentError
+}
+
+type UndefinedNodeError struct {
+	*dag.UndefinedNodeError
+
+	Node string
+	Edge Edge
+}
+
+func (e *UndefinedNodeError) Error() string {
+	return e.UndefinedNodeError.Error()
+}
+
+func (e *UndefinedNodeError) Unwrap() error {
+	return e.UndefinedNodeError
+}
+
+type DuplicateEdgeError struct {
+	*dag.DuplicateEdgeError
+
+	Edge Edge
+}
+
+func (e *DuplicateEdgeError) Error() string {
+	return e.DuplicateEdgeError.Error()
+}
+
+func (e *DuplicateEdgeError) Unwrap() error {
+	return e.DuplicateEdgeError
+}
+
+type IsolatedNodeError struct {
+	*dag.IsolatedNodeError
+
+	Node string
+}
+
+func (e *IsolatedNodeError) Error() string {
+	return e.IsolatedNodeError.Error()
+}
+
+func (e *IsolatedNodeError) Unwrap() error {
+	return e.IsolatedNodeError
+}
+
+type MergeConflictError struct {
+	*dag.MergeConflictError
+
+	Node string
+}
+
+func (e *MergeConflictError) Error() string {
+	return e.MergeConflictError.Error()
+}
+
+func (e *MergeConflictError) Unwrap() error {
+	return e.MergeConflictError
+}
+
+var (
+	ErrCycle     = dag.ErrCycle
+	ErrUndefined = dag.ErrUndefined
+	ErrUnhandled = dag.ErrUnhandled
+)
+
+// positionsOf returns the known positions where the edges are defined in the source document
+func (d *DAG) positionsOf(edges []Edge) []Position {
+	var ps []Position
+
+	for _, e := range edges {
+		if p, ok := d.refs[e]; ok {
+			ps = append(ps, p)
+		}
+	}
+
+	return ps
+}
+
+// transformErr converts the errors that refer to nodes by dag.Key into the ones that refer to nodes by string
+func (d *DAG) transformErr(err error) error {
+	switch e := err.(type) {
+	case *dag.Error:
+		path := dag.KeysToStringSlice(e.Cycle.Path)
+
+		var edges []Edge
+		for i := 0; i+1 < len(path); i++ {
+			edges = append(edges, Edge{From: path[i], To: path[i+1]})
+		}
+
+		return &CycleError{
+			Cycle:     &Cycle{Path: path},
+			Positions: d.positionsOf(edges),
+			err:       e,
+		}
+	case *dag.SelfLoopError:
+		node := fmt.Sprintf("%s", e.Node)
+
+		return &SelfLoopError{
+			SelfLoopError: e,
+			Node:          node,
+			Positions:     d.positionsOf([]Edge{{From: node, To: node}}),
+		}
+	case *dag.UndefinedDependencyError:
+		undefined := fmt.Sprintf("%s", e.UndefinedNode)
+		dependents := dag.KeysToStringSlice(e.Dependents)
+
+		var edges []Edge
+		for _, dep := range dependents {
+			edges = append(edges, Edge{From: undefined, To: dep})
+		}
+
+		return &UndefinedDependencyError{
+			UndefinedDependencyError: e,
+			UndefinedNode:            undefined,
+			Dependents:               dependents,
+			Positions:                d.positionsOf(edges),
+		}
+	case *dag.UndefinedDependentError:
+		undefined := fmt.Sprintf("%s", e.UndefinedNode)
+		dependencies := dag.KeysToStringSlice(e.Dependencies)
+
+		var edges []Edge
+		for _, dep := range dependencies {
+			edges = append(edges, Edge{From: dep, To: undefined})
+		}
+
+		return &UndefinedDependentError{
+			UndefinedDependentError: e,
+			UndefinedNode:           undefined,
+			Dependencies:            dependencies,
+			Positions:               d.positionsOf(edges),
+		}
+	case *dag.UndefinedNodeError:
+		return &UndefinedNodeError{
+			UndefinedNodeError: e,
+			Node:               fmt.Sprintf("%s", e.Node),
+			Edge:               transformEdge(e.Edge),
+		}
+	case *dag.DuplicateEdgeError:
+		return &DuplicateEdgeError{
+			DuplicateEdgeError: e,
+			Edge:               transformEdge(e.Edge),
+		}
+	case *dag.IsolatedNodeError:
+		return &IsolatedNodeError{
+			IsolatedNodeError: e,
+			Node:              fmt.Sprintf("%s", e.Node),
+		}
+	case *dag.MergeConflictError:
+		return &MergeConflictError{
+			MergeConflictError: e,
+			Node:               fmt.Sprintf("%s", e.Node),
+		}
+	case *dag.UnhandledDependencyError:
+		var uds []UnhandledDependency
+
+		for _, ud := range e.UnhandledDependencies {
+			uds = append(uds, UnhandledDependency{
+				Id:         fmt.Sprintf("%s", ud.Id),
+				Dependents: dag.KeysToStringSlice(ud.Dependents),
+			})
+		}
+
+		return &UnhandledDependencyError{
+			UnhandledDependencyError: e,
+			UnhandledDependencies:    uds,
+		}
+	}
+
+	return err
+}
+
 // Option
 
 var Capacity = dag.Capacity
+var ThreadSafe = dag.ThreadSafe
+var Strict = dag.Strict
+var Incremental = dag.Incremental
+var UndefinedDependencies = dag.UndefinedDependencies
+var Warnings = dag.Warnings
 
 // AddOption
 
@@ -63,6 +360,26 @@ var Labels = dag.Labels
 var WithDependencies = dag.WithDependencies
 var WithoutDependencies = dag.WithoutDependencies
 
+// MergeOption
+
+var FailOnDuplicateNode = dag.FailOnDuplicateNode
+var FailOnLabelConflict = dag.FailOnLabelConflict
+
+// DotOption
+
+var RankDir = dag.RankDir
+var NodeShape = dag.NodeShape
+var LabelStyle = dag.LabelStyle
+var ClusterByLabelPrefix = dag.ClusterByLabelPrefix
+
+func Highlight(ids ...string) DotOption {
+	return dag.Highlight(stringsToKeys(ids)...)
+}
+
+// MermaidOption
+
+var GroupByLevel = dag.GroupByLevel
+
 func Nodes(ids []string) Option {
 	return dag.Nodes(stringsToKeys(ids))
 }
@@ -81,6 +398,10 @@ func New(opt ...Option) *DAG {
 	return &DAG{d: d}
 }
 
+func (d *DAG) Clone() *DAG {
+	return &DAG{d: d.d.Clone(), refs: d.refs}
+}
+
 func (d *DAG) Add(id string, opts ...dag.AddOption) {
 	d.d.Add(StringKey(id), opts...)
 }
@@ -93,13 +414,22 @@ func (d *DAG) AddEdge(from, to string) {
 	d.d.AddEdge(StringKey(from), StringKey(to))
 }
 
+func (d *DAG) AddEdgeE(from, to string) error {
+	return d.transformErr(d.d.AddEdgeE(StringKey(from), StringKey(to)))
+}
+
+func (d *DAG) RemoveEdge(from, to string) bool {
+	return d.d.RemoveEdge(StringKey(from), StringKey(to))
+}
+
 func (d *DAG) AddDependencies(id string, deps []string) {
 	d.d.AddDependencies(StringKey(id), stringsToKeys(deps))
 }
 
 type Topology [][]*NodeInfo
 
-func (r Topology) String() string {
+// toDAGTopology converts the topology back to the one of the dag package
+func (r Topology) toDAGTopology() dag.Topology {
 	var t dag.Topology
 
 	for _, group := range r {
@@ -107,22 +437,45 @@ func (r Topology) String() string {
 
 		for _, e := range group {
 			newGroup = append(newGroup, &dag.NodeInfo{
-				Id:        StringKey(e.Id),
-				ParentIds: stringsToKeys(e.ParentIds),
-				ChildIds:  stringsToKeys(e.ChildIds),
+				Id:          StringKey(e.Id),
+				ParentIds:   stringsToKeys(e.ParentIds),
+				ChildIds:    stringsToKeys(e.ChildIds),
+				Placeholder: e.Placeholder,
 			})
 		}
 
 		t = append(t, newGroup)
 	}
 
-	return t.String()
+	return t
+}
+
+func (r Topology) String() string {
+	return r.toDAGTopology().String()
+}
+
+func (r Topology) MarshalJSON() ([]byte, error) {
+	return r.toDAGTopology().MarshalJSON()
+}
+
+var ParseTopology = dag.ParseTopology
+
+func (r Topology) WriteDotTo(w io.Writer) error {
+	return r.toDAGTopology().WriteDotTo(w)
 }
 
+func (r Topology) WriteTreeTo(w io.Writer) error {
+	return r.toDAGTopology().WriteTreeTo(w)
+}
+
+// NodeInfo is tagged to be decoded from the JSON form of Topology
 type NodeInfo struct {
-	Id        string
-	ParentIds []string
-	ChildIds  []string
+	Id        string   `json:"id"`
+	ParentIds []string `json:"parents"`
+	ChildIds  []string `json:"children"`
+
+	// Placeholder is true when the node is not added to the graph but included as a dependency of other nodes
+	Placeholder bool `json:"placeholder,omitempty"`
 }
 
 func (n *NodeInfo) String() string {
@@ -130,43 +483,306 @@ func (n *NodeInfo) String() string {
 }
 
 func (d *DAG) Sort(opts ...SortOption) (Topology, error) {
-	return transformPlanResAndErr(d.d.Sort(opts...))
+	return d.transformPlanResAndErr(d.d.Sort(opts...))
 }
 
 func (d *DAG) Plan(opts ...SortOption) (Topology, error) {
-	return transformPlanResAndErr(d.d.Plan(opts...))
+	return d.transformPlanResAndErr(d.d.Plan(opts...))
 }
 
 func (d *DAG) WriteDotTo(w io.Writer) error {
 	return d.d.WriteDotTo(w)
 }
 
-func transformPlanResAndErr(t dag.Topology, err error) (Topology, error) {
-	if err != nil {
-		ude, ok := err.(*dag.UnhandledDependencyError)
-		if ok {
-			var uds []UnhandledDependency
+func (d *DAG) WriteTextTo(w io.Writer) error {
+	return d.transformErr(d.d.WriteTextTo(w))
+}
+
+func (d *DAG) WriteDot(w io.Writer, opts ...DotOption) error {
+	return d.d.WriteDot(w, opts...)
+}
 
-			for _, ud := range ude.UnhandledDependencies {
-				var deps []string
+func (d *DAG) WriteMermaidTo(w io.Writer, opts ...MermaidOption) error {
+	return d.transformErr(d.d.WriteMermaidTo(w, opts...))
+}
 
-				for _, d := range ud.Dependents {
-					deps = append(deps, fmt.Sprintf("%s", d))
-				}
+func (d *DAG) WriteGraphMLTo(w io.Writer) error {
+	return d.transformErr(d.d.WriteGraphMLTo(w))
+}
 
-				uds = append(uds, UnhandledDependency{
-					Id:         fmt.Sprintf("%s", ud.Id),
-					Dependents: deps,
-				})
-			}
+func (d *DAG) WriteGEXFTo(w io.Writer) error {
+	return d.transformErr(d.d.WriteGEXFTo(w))
+}
 
-			err = &UnhandledDependencyError{
-				UnhandledDependencyError: ude,
-				UnhandledDependencies:    uds,
-			}
+// stringKeyCodec serializes StringKeys as they are
+var stringKeyCodec = dag.KeyCodecFuncs{
+	Encode: func(k dag.Key) (string, error) {
+		sk, ok := k.(StringKey)
+		if !ok {
+			return "", fmt.Errorf("unexpected type of Key %T: %v", k, k)
 		}
+		return string(sk), nil
+	},
+	Decode: func(s string) (dag.Key, error) {
+		return StringKey(s), nil
+	},
+}
+
+func (d *DAG) WriteJSONTo(w io.Writer) error {
+	return d.d.WriteJSONTo(w, stringKeyCodec)
+}
+
+func ReadJSON(r io.Reader, opts ...Option) (*DAG, error) {
+	d, err := dag.ReadJSON(r, stringKeyCodec, opts...)
+	if err != nil {
+		// The document has no positions to report
+		return nil, (&DAG{}).transformErr(err)
+	}
+
+	return &DAG{d: d}, nil
+}
+
+func (d *DAG) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := d.WriteJSONTo(&buf); err != nil {
+		return nil, err
 	}
 
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON replaces the graph with the one read from the JSON document.
+// The graph is created without any Option, so use ReadJSON for e.g. a ThreadSafe graph.
+func (d *DAG) UnmarshalJSON(b []byte) error {
+	g, err := ReadJSON(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	*d = *g
+
+	return nil
+}
+
+func (d *DAG) WalkOrderings(limit int, fn func(order []string) bool) error {
+	return d.transformErr(d.d.WalkOrderings(limit, func(order []dag.Key) bool {
+		return fn(dag.KeysToStringSlice(order))
+	}))
+}
+
+func (d *DAG) Orderings(limit int) ([][]string, error) {
+	orders, err := d.d.Orderings(limit)
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	var res [][]string
+
+	for _, o := range orders {
+		res = append(res, dag.KeysToStringSlice(o))
+	}
+
+	return res, nil
+}
+
+func (d *DAG) CountOrderings() (*big.Int, error) {
+	c, err := d.d.CountOrderings()
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	return c, nil
+}
+
+func (d *DAG) RandomOrder(seed int64) ([]string, error) {
+	order, err := d.d.RandomOrder(seed)
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	return dag.KeysToStringSlice(order), nil
+}
+
+type RedundantEdge struct {
+	From string
+	To   string
+	Path []string
+}
+
+func (e *RedundantEdge) String() string {
+	return fmt.Sprintf("%s -> %s is implied by %s", e.From, e.To, strings.Join(e.Path, " -> "))
+}
+
+func (d *DAG) RedundantEdges() ([]*RedundantEdge, error) {
+	edges, err := d.d.RedundantEdges()
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	var res []*RedundantEdge
+
+	for _, e := range edges {
+		res = append(res, &RedundantEdge{
+			From: fmt.Sprintf("%s", e.From),
+			To:   fmt.Sprintf("%s", e.To),
+			Path: dag.KeysToStringSlice(e.Path),
+		})
+	}
+
+	return res, nil
+}
+
+func (d *DAG) TransitiveReduction() (*DAG, error) {
+	r, err := d.d.TransitiveReduction()
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	return &DAG{d: r}, nil
+}
+
+func (d *DAG) TransitiveClosure() (*DAG, error) {
+	c, err := d.d.TransitiveClosure()
+	if err != nil {
+		return nil, d.transformErr(err)
+	}
+
+	return &DAG{d: c}, nil
+}
+
+func (d *DAG) Reachable(from, to string) bool {
+	return d.d.Reachable(StringKey(from), StringKey(to))
+}
+
+func (d *DAG) Validate() []error {
+	var errs []error
+
+	for _, err := range d.d.Validate() {
+		errs = append(errs, d.transformErr(err))
+	}
+
+	return errs
+}
+
+func (d *DAG) Subgraph(ids ...string) *DAG {
+	return &DAG{d: d.d.Subgraph(stringsToKeys(ids)...)}
+}
+
+func (d *DAG) Induced(include func(id string) bool) *DAG {
+	return &DAG{d: d.d.Induced(func(k dag.Key) bool {
+		return include(fmt.Sprintf("%s", k))
+	})}
+}
+
+type Edge struct {
+	From string
+	To   string
+}
+
+type MergeReport struct {
+	Nodes  map[string][]int
+	Edges  map[Edge][]int
+	Labels map[string]map[string][]int
+}
+
+func Merge(graphs ...*DAG) (*DAG, *MergeReport, error) {
+	return MergeWithOptions(graphs)
+}
+
+func MergeWithOptions(graphs []*DAG, opts ...MergeOption) (*DAG, *MergeReport, error) {
+	ds := make([]*dag.DAG, len(graphs))
+	for i, g := range graphs {
+		ds[i] = g.d
+	}
+
+	m, r, err := dag.MergeWithOptions(ds, opts...)
+	if err != nil {
+		// Merged graphs have no positions to report
+		return nil, nil, (&DAG{}).transformErr(err)
+	}
+
+	report := &MergeReport{
+		Nodes:  map[string][]int{},
+		Edges:  map[Edge][]int{},
+		Labels: map[string]map[string][]int{},
+	}
+
+	for k, sources := range r.Nodes {
+		report.Nodes[fmt.Sprintf("%s", k)] = sources
+	}
+
+	for e, sources := range r.Edges {
+		report.Edges[Edge{From: fmt.Sprintf("%s", e.From), To: fmt.Sprintf("%s", e.To)}] = sources
+	}
+
+	for k, labels := range r.Labels {
+		report.Labels[fmt.Sprintf("%s", k)] = labels
+	}
+
+	return &DAG{d: m}, report, nil
+}
+
+type LabelChange struct {
+	Node    string
+	Added   []string
+	Removed []string
+}
+
+type GraphDiff struct {
+	*dag.GraphDiff
+
+	AddedNodes    []string
+	RemovedNodes  []string
+	AddedEdges    []Edge
+	RemovedEdges  []Edge
+	ChangedLabels []LabelChange
+}
+
+func Diff(a, b *DAG) *GraphDiff {
+	d := dag.Diff(a.d, b.d)
+
+	return &GraphDiff{
+		GraphDiff:     d,
+		AddedNodes:    dag.KeysToStringSlice(d.AddedNodes),
+		RemovedNodes:  dag.KeysToStringSlice(d.RemovedNodes),
+		AddedEdges:    transformEdges(d.AddedEdges),
+		RemovedEdges:  transformEdges(d.RemovedEdges),
+		ChangedLabels: transformLabelChanges(d.ChangedLabels),
+	}
+}
+
+func transformEdges(edges []dag.Edge) []Edge {
+	var res []Edge
+
+	for _, e := range edges {
+		res = append(res, transformEdge(e))
+	}
+
+	return res
+}
+
+func transformEdge(e dag.Edge) Edge {
+	return Edge{From: fmt.Sprintf("%s", e.From), To: fmt.Sprintf("%s", e.To)}
+}
+
+func transformLabelChanges(changes []dag.LabelChange) []LabelChange {
+	var res []LabelChange
+
+	for _, c := range changes {
+		res = append(res, LabelChange{
+			Node:    fmt.Sprintf("%s", c.Node),
+			Added:   c.Added,
+			Removed: c.Removed,
+		})
+	}
+
+	return res
+}
+
+func (d *DAG) transformPlanResAndErr(t dag.Topology, err error) (Topology, error) {
+	err = d.transformErr(err)
+
 	var transformed Topology
 
 	for _, group := range t {
@@ -174,9 +790,10 @@ func transformPlanResAndErr(t dag.Topology, err error) (Topology, error) {
 
 		for _, info := range group {
 			infoTransformed = append(infoTransformed, &NodeInfo{
-				Id:        fmt.Sprintf("%s", info.Id),
-				ParentIds: dag.KeysToStringSlice(info.ParentIds),
-				ChildIds:  dag.KeysToStringSlice(info.ChildIds),
+				Id:          fmt.Sprintf("%s", info.Id),
+				ParentIds:   dag.KeysToStringSlice(info.ParentIds),
+				ChildIds:    dag.KeysToStringSlice(info.ChildIds),
+				Placeholder: info.Placeholder,
 			})
 		}
 
@@ -0,0 +1,112 @@
+package strdag
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlGraph is the YAML document of a graph, e.g.
+//
+//	nodes:
+//	- name: web
+//	  dependsOn: [api, net]
+//	  labels: [tier:web]
+//	- name: api
+//	  dependsOn: [net]
+//	- name: net
+type yamlGraph struct {
+	Nodes []yamlNode `yaml:"nodes"`
+}
+
+type yamlNode struct {
+	// Name and DependsOn are decoded as yaml.Node to keep their positions in the document
+	Name      yaml.Node   `yaml:"name"`
+	DependsOn []yaml.Node `yaml:"dependsOn"`
+	Labels    []string    `yaml:"labels"`
+}
+
+// LoadYAML reads the graph from the YAML file. See ReadYAML for the format.
+func LoadYAML(path string, opts ...Option) (*DAG, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadYAML(f, path, opts...)
+}
+
+// ReadYAML returns a new graph created with the options from the YAML document, which lists nodes
+// under the "nodes" key, each with its "name" and optional "dependsOn" and "labels".
+//
+// The position of every dependency in the document is remembered, so that cycles and undefined dependencies
+// found later by Sort and Validate are reported along with the file, line and column to fix.
+// With Strict, dependencies on nodes not listed in the document are reported right away along with their positions.
+// file is used only for reporting positions, and can be empty.
+func ReadYAML(r io.Reader, file string, opts ...Option) (*DAG, error) {
+	var doc yamlGraph
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", fileOrDefault(file), err)
+	}
+
+	d := New(opts...)
+	d.refs = map[Edge]Position{}
+
+	positionOf := func(n *yaml.Node) Position {
+		return Position{File: file, Line: n.Line, Column: n.Column}
+	}
+
+	defined := map[string]Position{}
+
+	// Nodes are added before edges, so that dependencies on nodes listed later are accepted by Strict graphs
+	for i := range doc.Nodes {
+		n := &doc.Nodes[i]
+
+		name := n.Name.Value
+		if n.Name.Kind != yaml.ScalarNode || name == "" {
+			return nil, fmt.Errorf("%s: node #%d has no name", fileOrDefault(file), i)
+		}
+
+		if p, ok := defined[name]; ok {
+			return nil, fmt.Errorf("%s: node %q is already defined at %s", positionOf(&n.Name), name, p)
+		}
+		defined[name] = positionOf(&n.Name)
+
+		d.Add(name, Labels(n.Labels))
+	}
+
+	for i := range doc.Nodes {
+		n := &doc.Nodes[i]
+		name := n.Name.Value
+
+		for j := range n.DependsOn {
+			dep := &n.DependsOn[j]
+
+			if dep.Kind != yaml.ScalarNode || dep.Value == "" {
+				return nil, fmt.Errorf("%s: dependency of node %q must be a node name", positionOf(dep), name)
+			}
+
+			d.refs[Edge{From: dep.Value, To: name}] = positionOf(dep)
+
+			if err := d.AddEdgeE(dep.Value, name); err != nil {
+				return nil, fmt.Errorf("%s: %v", positionOf(dep), err)
+			}
+		}
+	}
+
+	return d, nil
+}
+
+func fileOrDefault(file string) string {
+	if file == "" {
+		return "<input>"
+	}
+	return file
+}